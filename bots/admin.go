@@ -0,0 +1,194 @@
+package bots
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/mong0520/linebot-ptt-beauty/controllers"
+	"github.com/mong0520/linebot-ptt-beauty/utils"
+)
+
+// adminCommand 是管理者可以執行的指令，不再呼叫任何外部程式
+type adminCommand struct {
+	name    string
+	usage   string
+	minArgs int
+	// maxArgs 小於 0 代表不限
+	maxArgs int
+	timeout time.Duration
+	run     func(ctx context.Context, args []string) (result string, err error)
+}
+
+var errAdminTimeout = errors.New("command timeout")
+
+var adminCommands = map[string]*adminCommand{}
+
+// adminUserIds 由環境變數 AdminUserIDs 設定 (以逗號分隔)，沒設定時沒有人能執行管理指令
+var adminUserIds = map[string]bool{}
+var adminLock sync.RWMutex
+
+func init() {
+	for _, c := range []*adminCommand{
+		{name: "stats", usage: "stats", timeout: 10 * time.Second, run: adminStats},
+		{name: "reindex", usage: "reindex", timeout: 30 * time.Second, run: adminReindex},
+		{name: "sync", usage: "sync now", minArgs: 1, maxArgs: 1, timeout: 30 * time.Second, run: adminSync},
+		{name: "broadcast", usage: "broadcast <訊息>", minArgs: 1, maxArgs: -1, timeout: 50 * time.Second, run: adminBroadcast},
+		{name: "reload", usage: "reload config", minArgs: 1, maxArgs: 1, timeout: 5 * time.Second, run: adminReload},
+	} {
+		adminCommands[c.name] = c
+	}
+}
+
+func loadAdminUserIds() {
+	ids := map[string]bool{}
+	for _, id := range strings.Split(os.Getenv("AdminUserIDs"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids[id] = true
+		}
+	}
+	adminLock.Lock()
+	adminUserIds = ids
+	adminLock.Unlock()
+	meta.Log.Printf("%d admin users loaded\n", len(ids))
+}
+
+func isAdmin(userId string) bool {
+	adminLock.RLock()
+	defer adminLock.RUnlock()
+	return userId != "" && adminUserIds[userId]
+}
+
+func adminUsage() string {
+	usages := []string{}
+	for _, c := range adminCommands {
+		usages = append(usages, ActionAdmin+" "+c.usage)
+	}
+	sort.Strings(usages)
+	return "可用的管理指令：\n" + strings.Join(usages, "\n")
+}
+
+// runAdminCommand 處理 /admin 開頭的訊息，每次執行 (包含被拒絕的) 都會寫入稽核記錄。
+// 非管理者不會收到任何回應，避免透露指令存在
+func runAdminCommand(event *linebot.Event, message string) {
+	userId := event.Source.UserID
+	args := strings.Fields(strings.TrimPrefix(strings.TrimSpace(message), ActionAdmin))
+	name := ""
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	audit := &controllers.AuditLog{UserId: userId, Command: name, Args: args}
+
+	if !isAdmin(userId) {
+		meta.Log.Printf("Reject admin command %q from User (%s)\n", name, utils.RedactID(userId))
+		audit.Error = "permission denied"
+		audit.Add(meta)
+		return
+	}
+	audit.Allowed = true
+
+	command, ok := adminCommands[name]
+	if !ok {
+		audit.Error = "unknown command"
+		audit.Add(meta)
+		sendTextMessage(event, adminUsage())
+		return
+	}
+	if len(args) < command.minArgs || (command.maxArgs >= 0 && len(args) > command.maxArgs) {
+		audit.Error = "invalid arguments"
+		audit.Add(meta)
+		sendTextMessage(event, "用法："+ActionAdmin+" "+command.usage)
+		return
+	}
+
+	meta.Log.Printf("Run admin command %s %v from User (%s)\n", name, args, utils.RedactID(userId))
+	result, err := command.execute(args)
+	audit.Result = result
+	if err != nil {
+		meta.Log.Printf("Admin command %s fail: %v\n", name, err)
+		audit.Error = err.Error()
+		result = fmt.Sprintf("%s 執行失敗：%v", name, err)
+	}
+	audit.Add(meta)
+	sendTextMessage(event, result)
+}
+
+// execute 在 timeout 內等待指令完成。資料庫操作無法中斷，逾時後會在背景跑完，但不再等待結果
+func (c *adminCommand) execute(args []string) (result string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	type output struct {
+		result string
+		err    error
+	}
+	done := make(chan output, 1)
+	go func() {
+		result, err := c.run(ctx, args)
+		done <- output{result, err}
+	}()
+	select {
+	case o := <-done:
+		return o.result, o.err
+	case <-ctx.Done():
+		return "", errAdminTimeout
+	}
+}
+
+func adminStats(ctx context.Context, args []string) (string, error) {
+	stats, err := controllers.GetStats(meta)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("文章數：%d\n使用者數：%d (未封鎖 %d)\n每日推播訂閱：%d\n排行榜更新時間：%s",
+		stats.Articles, stats.Users, stats.ActiveUsers, stats.OnThisDaySubscribe,
+		stats.LeaderboardUpdated.Format("2006-01-02 15:04:05")), nil
+}
+
+func adminReindex(ctx context.Context, args []string) (string, error) {
+	if err := controllers.EnsureIndexes(meta); err != nil {
+		return "", err
+	}
+	return "索引已建立", nil
+}
+
+func adminSync(ctx context.Context, args []string) (string, error) {
+	if args[0] != "now" {
+		return "", fmt.Errorf("unknown sync target %q", args[0])
+	}
+	if err := controllers.RefreshLeaderboard(meta, maxCountOfCarousel); err != nil {
+		return "", err
+	}
+	return "排行榜已重新計算", nil
+}
+
+func adminBroadcast(ctx context.Context, args []string) (string, error) {
+	text := strings.Join(args, " ")
+	if utf8.RuneCountInString(text) > maxTextMessageLength {
+		return "", fmt.Errorf("message is over %d characters", maxTextMessageLength)
+	}
+	userIds, err := controllers.GetAllUserIds(meta)
+	if err != nil {
+		return "", err
+	}
+	sent, err := multicastMessage(ctx, userIds, linebot.NewTextMessage(text))
+	if err != nil {
+		return fmt.Sprintf("已送出 %d/%d 位使用者", sent, len(userIds)), err
+	}
+	return fmt.Sprintf("已廣播給 %d 位使用者", sent), nil
+}
+
+func adminReload(ctx context.Context, args []string) (string, error) {
+	if args[0] != "config" {
+		return "", fmt.Errorf("unknown reload target %q", args[0])
+	}
+	loadConfig()
+	return fmt.Sprintf("設定已重新載入，文章卡片：%s", getArticleRenderer()), nil
+}
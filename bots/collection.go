@@ -0,0 +1,230 @@
+package bots
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/mong0520/linebot-ptt-beauty/controllers"
+)
+
+const (
+	CodeCollections      ActionCode = "cs"
+	CodeChooseCollection ActionCode = "cc"
+	CodeMoveFavorite     ActionCode = "mv"
+)
+
+// 收藏夾的文字指令，例如「新增收藏夾 長髮」、「收藏夾改名 長髮 黑長直」。
+// 指令只有中文，其他語言的說明也是請使用者輸入中文指令
+const (
+	CollectionCreateCommand string = "新增收藏夾"
+	CollectionRenameCommand string = "收藏夾改名"
+	CollectionDeleteCommand string = "刪除收藏夾"
+	CollectionAll           string = "全部"
+	CollectionNone          string = "未分類"
+)
+
+func init() {
+	registerRoute(&Route{Code: CodeCollections, Label: ActionCollections, Triggers: []string{ActionCollections},
+		Help: "分類收藏", MenuOrder: 35, Handler: actionCollections})
+	registerRoute(&Route{Code: CodeChooseCollection, Label: ActionChooseCollection, Help: "選擇收藏夾", Handler: actionChooseCollection})
+	registerRoute(&Route{Code: CodeMoveFavorite, Label: "移到收藏夾", Help: "移到收藏夾", Handler: actionMoveFavorite})
+}
+
+// 快速回覆最多 13 個，扣掉「全部」與「未分類」
+var maxCollections = 10
+var maxCollectionNameLength = 12
+
+func getCollectionTips(locale string) string {
+	return tr(locale, "collection.tips",
+		CollectionCreateCommand, CollectionRenameCommand, CollectionDeleteCommand, ShareCreateCommand)
+}
+
+// collectionDisplayName 把「全部」與「未分類」換成該語言的名稱，使用者自己取的名稱不變
+func collectionDisplayName(locale string, name string) string {
+	switch name {
+	case CollectionAll:
+		return tr(locale, "collection.all")
+	case CollectionNone:
+		return tr(locale, "collection.none")
+	}
+	return name
+}
+
+func getUserFavorite(userId string) (*controllers.UserFavorite, error) {
+	userFavorite := &controllers.UserFavorite{
+		UserId:    userId,
+		Favorites: []controllers.FavoriteItem{},
+	}
+	// 還沒有記錄的使用者視為沒有最愛，等到真的加入最愛時才建立
+	userData, err := userFavorite.GetOrEmpty(meta)
+	if err != nil {
+		return nil, err
+	}
+	return userData, nil
+}
+
+// collectionTextHandler 處理收藏夾的文字指令，回傳是否有處理
+func collectionTextHandler(event *linebot.Event, message string) bool {
+	fields := strings.Fields(message)
+	if len(fields) == 0 {
+		return false
+	}
+	command, args := fields[0], fields[1:]
+	if command != CollectionCreateCommand && command != CollectionRenameCommand && command != CollectionDeleteCommand {
+		return false
+	}
+	locale := getLocale(event)
+	if getGroupId(event.Source) != "" || event.Source.UserID == "" {
+		sendTextMessage(event, tr(locale, "collection.private_only"))
+		return true
+	}
+	if (command == CollectionRenameCommand && len(args) != 2) || (command != CollectionRenameCommand && len(args) != 1) {
+		sendTextMessage(event, getCollectionTips(locale))
+		return true
+	}
+	for _, name := range args {
+		if utf8.RuneCountInString(name) > maxCollectionNameLength || name == CollectionAll || name == CollectionNone {
+			sendTextMessage(event, tr(locale, "collection.invalid_name", maxCollectionNameLength, CollectionAll, CollectionNone))
+			return true
+		}
+	}
+	userData, err := getUserFavorite(event.Source.UserID)
+	if err != nil {
+		sendTextMessage(event, tr(locale, "error.setting"))
+		return true
+	}
+
+	switch command {
+	case CollectionCreateCommand:
+		if len(userData.Collections) >= maxCollections {
+			sendTextMessage(event, tr(locale, "collection.too_many", maxCollections))
+			return true
+		}
+		if _, err := userData.CreateCollection(meta, args[0]); err == controllers.ErrCollectionExists {
+			sendTextMessage(event, tr(locale, "collection.exists", args[0]))
+		} else if err != nil {
+			sendTextMessage(event, tr(locale, "error.setting"))
+		} else {
+			sendTextMessage(event, tr(locale, "collection.created", args[0]))
+		}
+	case CollectionRenameCommand:
+		collection := userData.GetCollectionByName(args[0])
+		if collection == nil {
+			sendTextMessage(event, tr(locale, "collection.not_found", args[0]))
+		} else if userData.GetCollectionByName(args[1]) != nil {
+			sendTextMessage(event, tr(locale, "collection.exists", args[1]))
+		} else if err := userData.RenameCollection(meta, collection.Id, args[1]); err != nil {
+			sendTextMessage(event, tr(locale, "error.setting"))
+		} else {
+			sendTextMessage(event, tr(locale, "collection.renamed", args[0], args[1]))
+		}
+	case CollectionDeleteCommand:
+		collection := userData.GetCollectionByName(args[0])
+		if collection == nil {
+			sendTextMessage(event, tr(locale, "collection.not_found", args[0]))
+		} else if err := userData.DeleteCollection(meta, collection.Id); err != nil {
+			sendTextMessage(event, tr(locale, "error.setting"))
+		} else {
+			sendTextMessage(event, tr(locale, "collection.deleted", args[0], len(collection.Articles), collectionDisplayName(locale, CollectionNone)))
+		}
+	}
+	return true
+}
+
+// actionCollections 列出收藏夾，快速回覆可以直接瀏覽某個收藏夾
+func actionCollections(event *linebot.Event, pb *Postback) {
+	if getGroupId(event.Source) != "" {
+		actionShowFavorite(event, &Postback{Action: CodeShowFavorite})
+		return
+	}
+	locale := getLocale(event)
+	userData, err := getUserFavorite(event.Source.UserID)
+	if err != nil {
+		sendTextMessage(event, tr(locale, "error.query"))
+		return
+	}
+	allName := collectionDisplayName(locale, CollectionAll)
+	noneName := collectionDisplayName(locale, CollectionNone)
+	dataAll := postbackData(&Postback{Action: CodeShowFavorite})
+	buttons := []*linebot.QuickReplyButton{
+		linebot.NewQuickReplyButton("", linebot.NewPostbackAction(allName, dataAll, "", allName)),
+	}
+	lines := []string{fmt.Sprintf("・%s (%d)", allName, len(userData.Favorites))}
+	categorized := 0
+	for _, collection := range userData.Collections {
+		categorized += len(collection.Articles)
+		lines = append(lines, fmt.Sprintf("・%s (%d)", collection.Name, len(collection.Articles)))
+		data := postbackData(&Postback{Action: CodeShowFavorite, Collection: collection.Id})
+		buttons = append(buttons, linebot.NewQuickReplyButton("",
+			linebot.NewPostbackAction(collection.Name, data, "", collection.Name)))
+	}
+	lines = append(lines, fmt.Sprintf("・%s (%d)", noneName, len(userData.Favorites)-categorized))
+	text := tr(locale, "collection.title") + "\n" + strings.Join(lines, "\n") + "\n\n" + getCollectionTips(locale)
+	message := linebot.NewTextMessage(text).WithQuickReplies(newQuickReplyItems(buttons...))
+	replyMessage(event, message)
+}
+
+// getCollectionButtons 產生把文章移到各收藏夾的快速回覆
+func getCollectionButtons(userData *controllers.UserFavorite, articleId string, locale string) []*linebot.QuickReplyButton {
+	buttons := []*linebot.QuickReplyButton{}
+	for _, collection := range userData.Collections {
+		data := postbackData(&Postback{Action: CodeMoveFavorite, ArticleID: articleId, Collection: collection.Id})
+		buttons = append(buttons, linebot.NewQuickReplyButton("",
+			linebot.NewPostbackAction("📁 "+collection.Name, data, "", collection.Name)))
+	}
+	if len(buttons) > 0 {
+		noneName := collectionDisplayName(locale, CollectionNone)
+		data := postbackData(&Postback{Action: CodeMoveFavorite, ArticleID: articleId})
+		buttons = append(buttons, linebot.NewQuickReplyButton("",
+			linebot.NewPostbackAction(noneName, data, "", noneName)))
+	}
+	return buttons
+}
+
+// sendCollectionChoice 回覆文字，並附上選擇收藏夾的快速回覆；沒有收藏夾時附上建立的說明
+func sendCollectionChoice(event *linebot.Event, text string, articleId string) {
+	locale := getLocale(event)
+	userData, err := getUserFavorite(event.Source.UserID)
+	if err != nil || len(userData.Collections) == 0 {
+		sendTextMessage(event, text+"\n\n"+tr(locale, "collection.create_hint", CollectionCreateCommand))
+		return
+	}
+	message := linebot.NewTextMessage(text + tr(locale, "collection.choose_suffix")).
+		WithQuickReplies(newQuickReplyItems(getCollectionButtons(userData, articleId, locale)...))
+	replyMessage(event, message)
+}
+
+func actionChooseCollection(event *linebot.Event, pb *Postback) {
+	if getGroupId(event.Source) != "" || pb.ArticleID == "" {
+		return
+	}
+	sendCollectionChoice(event, tr(getLocale(event), "collection.choose"), pb.ArticleID)
+}
+
+func actionMoveFavorite(event *linebot.Event, pb *Postback) {
+	if getGroupId(event.Source) != "" || pb.ArticleID == "" {
+		return
+	}
+	locale := getLocale(event)
+	userData, err := getUserFavorite(event.Source.UserID)
+	if err != nil {
+		sendTextMessage(event, tr(locale, "error.setting"))
+		return
+	}
+	name := collectionDisplayName(locale, CollectionNone)
+	if pb.Collection != "" {
+		collection := userData.GetCollection(pb.Collection)
+		if collection == nil {
+			sendTextMessage(event, tr(locale, "collection.deleted_already"))
+			return
+		}
+		name = collection.Name
+	}
+	if err := userData.MoveFavorite(meta, pb.ArticleID, pb.Collection); err != nil {
+		sendTextMessage(event, tr(locale, "error.setting"))
+		return
+	}
+	sendTextMessage(event, tr(locale, "collection.moved", name))
+}
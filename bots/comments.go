@@ -0,0 +1,121 @@
+package bots
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/mong0520/linebot-ptt-beauty/controllers"
+	"github.com/mong0520/linebot-ptt-beauty/models"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	CodeMore     ActionCode = "mo"
+	CodeComments ActionCode = "cm"
+)
+
+func init() {
+	registerRoute(&Route{Code: CodeMore, Label: ActionMore, Help: "文章的更多選項", Handler: actionArticleMenu})
+	registerRoute(&Route{Code: CodeComments, Label: ActionComments, Help: "看推文", Handler: actionComments})
+}
+
+var commentsPerPage = 20
+
+func actionArticleMenu(event *linebot.Event, pb *Postback) {
+	articleId := pb.ArticleID
+	locale := getLocale(event)
+	result, err := controllers.GetOne(meta.Collection, bson.M{"article_id": articleId})
+	if err != nil {
+		meta.Log.Println("Unable to get article", articleId, err)
+		sendTextMessage(event, tr(locale, "article.missing"))
+		return
+	}
+	thumnailUrl := defaultImage
+	if len(result.ImageLinks) > 0 {
+		thumnailUrl = result.ImageLinks[0]
+	}
+	text := fmt.Sprintf("%d 😍\t%d 😡", result.MessageCount.Push, result.MessageCount.Boo)
+	dataPreview := postbackData(&Postback{Action: CodeAllImage, ArticleID: articleId})
+	dataComments := postbackData(&Postback{Action: CodeComments, ArticleID: articleId})
+	dataSummary := postbackData(&Postback{Action: CodeSummary, ArticleID: articleId})
+	// 文章卡片上已經有打開原文的按鈕，這裡放卡片上放不下的預覽圖片
+	previewLabel := fmt.Sprintf("%s (%d)", actionLabel(CodeAllImage, locale), len(result.ImageLinks))
+	actions := []linebot.TemplateAction{
+		linebot.NewPostbackAction(previewLabel, dataPreview, "", ""),
+		linebot.NewPostbackAction(actionLabel(CodeSummary, locale), dataSummary, "", ""),
+		linebot.NewPostbackAction(actionLabel(CodeComments, locale), dataComments, "", ""),
+	}
+	// 作者欄位是 "id (暱稱)"，訂閱時只用 id
+	if fields := strings.Fields(result.Author); len(fields) > 0 {
+		dataSubscribe := postbackData(&Postback{Action: CodeSubscribe, Author: fields[0]})
+		actions = append(actions, linebot.NewPostbackAction(actionLabel(CodeSubscribe, locale), dataSubscribe, "", ""))
+	}
+	template := linebot.NewButtonsTemplate(thumnailUrl, result.ArticleTitle, text, actions...)
+	quickReplies := getQuickReplyItems(event, nil)
+	if getGroupId(event.Source) == "" {
+		collectionLabel := actionLabel(CodeChooseCollection, locale)
+		dataCollection := postbackData(&Postback{Action: CodeChooseCollection, ArticleID: articleId})
+		quickReplies = newQuickReplyItems(append([]*linebot.QuickReplyButton{linebot.NewQuickReplyButton("",
+			linebot.NewPostbackAction(collectionLabel, dataCollection, "", collectionLabel))}, quickReplies.Items...)...)
+	}
+	message := linebot.NewTemplateMessage(AltText, template).WithQuickReplies(quickReplies)
+	replyMessage(event, message)
+}
+
+func actionComments(event *linebot.Event, pb *Postback) {
+	articleId := pb.ArticleID
+	page := pb.Page
+	locale := getLocale(event)
+	result, err := controllers.GetOne(meta.Collection, bson.M{"article_id": articleId})
+	if err != nil {
+		meta.Log.Println("Unable to get article", articleId, err)
+		sendTextMessage(event, tr(locale, "article.missing"))
+		return
+	}
+	// 依推了同樣內容的人數排序後再分頁，第一頁就是最熱門的推文
+	pushes := result.TopPushMessages()
+	if len(pushes) == 0 {
+		sendTextMessage(event, tr(locale, "comments.empty"))
+		return
+	}
+	totalPage := (len(pushes) + commentsPerPage - 1) / commentsPerPage
+	if page < 0 || page >= totalPage {
+		page = 0
+	}
+	startIdx := page * commentsPerPage
+	endIdx := startIdx + commentsPerPage
+	if endIdx > len(pushes) {
+		endIdx = len(pushes)
+	}
+
+	messages := []linebot.SendingMessage{
+		linebot.NewTextMessage(formatComments(result, pushes[startIdx:endIdx], page, totalPage)),
+	}
+	if page+1 < totalPage {
+		nextData := postbackData(&Postback{Action: CodeComments, ArticleID: articleId, Page: page + 1})
+		template := linebot.NewButtonsTemplate(
+			"",
+			"",
+			tr(locale, "comments.remaining", len(pushes)-endIdx),
+			linebot.NewPostbackAction(tr(locale, "comments.next"), nextData, "", ""),
+		)
+		messages = append(messages, linebot.NewTemplateMessage(tr(locale, "alt.more_comments"), template))
+	}
+	last := len(messages) - 1
+	messages[last] = messages[last].WithQuickReplies(getQuickReplyItems(event, nil))
+	replyMessage(event, messages...)
+}
+
+func formatComments(record *models.ArticleDocument, pushes []models.PushComment, page int, totalPage int) string {
+	lines := []string{fmt.Sprintf("💬 %s (%d/%d)", record.ArticleTitle, page+1, totalPage)}
+	for _, push := range pushes {
+		content := strings.TrimSpace(strings.TrimPrefix(push.PushContent, ":"))
+		line := fmt.Sprintf("%s %s: %s", strings.TrimSpace(push.PushTag), push.PushUserID, content)
+		if push.Count > 1 {
+			line = fmt.Sprintf("%s (+%d)", line, push.Count-1)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,252 @@
+package bots
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/mong0520/linebot-ptt-beauty/controllers"
+	"github.com/mong0520/linebot-ptt-beauty/models"
+	"github.com/mong0520/linebot-ptt-beauty/utils"
+)
+
+const (
+	CodeDigest          ActionCode = "dg"
+	CodeDailyDigest     ActionCode = "dd"
+	CodeWeeklyDigestDay ActionCode = "dw"
+	CodeWeeklyDigest    ActionCode = "dt"
+	CodeCancelDigest    ActionCode = "dx"
+)
+
+func init() {
+	registerRoute(&Route{Code: CodeDigest, Label: ActionDigest, Triggers: []string{ActionDigest},
+		Help: "定時推播熱門", MenuOrder: 140, Handler: actionDigest})
+	registerRoute(&Route{Code: CodeDailyDigest, Label: ActionDailyDigest, Help: "設定每日摘要", Handler: actionSetDailyDigest})
+	registerRoute(&Route{Code: CodeWeeklyDigestDay, Label: ActionWeeklyDigest, Help: "選擇每週摘要的日子", Handler: actionChooseWeeklyDigest})
+	registerRoute(&Route{Code: CodeWeeklyDigest, Label: "設定每週摘要", Help: "設定每週摘要", Handler: actionSetWeeklyDigest})
+	registerRoute(&Route{Code: CodeCancelDigest, Label: ActionCancelDigest, Help: "取消摘要", Handler: actionCancelDigest})
+}
+
+// 檢查是否有該送的摘要的間隔
+var digestPollInterval = time.Minute
+var defaultDigestTime = "21:00"
+
+// 時間選擇器只選時間，SDK 沒有提供 mode 的常數
+var datetimePickerModeTime = "time"
+
+// getWeekdayName 回傳星期幾在該語言的名稱，例如「週一」
+func getWeekdayName(locale string, weekday time.Weekday) string {
+	return tr(locale, fmt.Sprintf("weekday.%d", weekday))
+}
+
+func getDigestStatus(digest *controllers.Digest, locale string) string {
+	status := []string{}
+	if digest.DailyTime != "" {
+		status = append(status, tr(locale, "digest.daily_status", digest.DailyTime))
+	}
+	if digest.WeeklyTime != "" {
+		status = append(status, tr(locale, "digest.weekly_status", getWeekdayName(locale, time.Weekday(digest.WeeklyDay)), digest.WeeklyTime))
+	}
+	if len(status) == 0 {
+		return tr(locale, "digest.none")
+	}
+	return tr(locale, "digest.status", strings.Join(status, tr(locale, "list.separator")))
+}
+
+// requireUserChat 摘要是推播給個人的，只能在一對一聊天設定
+func requireUserChat(event *linebot.Event) bool {
+	if getGroupId(event.Source) != "" || event.Source.UserID == "" {
+		sendTextMessage(event, tr(getLocale(event), "digest.private_only"))
+		return false
+	}
+	return true
+}
+
+func actionDigest(event *linebot.Event, pb *Postback) {
+	if !requireUserChat(event) {
+		return
+	}
+	locale := getLocale(event)
+	digest := &controllers.Digest{UserId: event.Source.UserID}
+	current, err := digest.Get(meta)
+	if err != nil {
+		sendTextMessage(event, tr(locale, "error.query"))
+		return
+	}
+	dailyTime := current.DailyTime
+	if dailyTime == "" {
+		dailyTime = defaultDigestTime
+	}
+	status := getDigestStatus(current, locale)
+	if getSettings(event).NoDigest {
+		status = tr(locale, "digest.paused") + "\n" + status
+	}
+	title := actionLabel(CodeDigest, locale)
+	cancelLabel := actionLabel(CodeCancelDigest, locale)
+	dataDaily := postbackData(&Postback{Action: CodeDailyDigest})
+	dataWeekly := postbackData(&Postback{Action: CodeWeeklyDigestDay})
+	dataCancel := postbackData(&Postback{Action: CodeCancelDigest})
+	template := linebot.NewButtonsTemplate(
+		"",
+		title,
+		status+"\n"+tr(locale, "digest.description"),
+		linebot.NewDatetimePickerAction(actionLabel(CodeDailyDigest, locale), dataDaily, datetimePickerModeTime, dailyTime, "", ""),
+		linebot.NewPostbackAction(actionLabel(CodeWeeklyDigestDay, locale), dataWeekly, "", ""),
+		linebot.NewPostbackAction(cancelLabel, dataCancel, "", cancelLabel),
+	)
+	message := linebot.NewTemplateMessage(title, template).WithQuickReplies(getQuickReplyItems(event, nil))
+	replyMessage(event, message)
+}
+
+// getPickedClock 取出時間選擇器選的時間，格式固定為 "HH:MM"
+func getPickedClock(event *linebot.Event) (clock string, ok bool) {
+	if event.Postback == nil || event.Postback.Params == nil {
+		return "", false
+	}
+	hour, minute, err := parseClock(event.Postback.Params.Time)
+	if err != nil {
+		return "", false
+	}
+	return fmt.Sprintf("%02d:%02d", hour, minute), true
+}
+
+func actionSetDailyDigest(event *linebot.Event, pb *Postback) {
+	if !requireUserChat(event) {
+		return
+	}
+	clock, ok := getPickedClock(event)
+	if !ok {
+		meta.Log.Println("No time picked for daily digest")
+		return
+	}
+	locale := getLocale(event)
+	digest := &controllers.Digest{UserId: event.Source.UserID}
+	if err := digest.SetDaily(meta, clock); err != nil {
+		sendTextMessage(event, tr(locale, "error.setting"))
+		return
+	}
+	sendTextMessage(event, tr(locale, "digest.daily_set", clock))
+}
+
+// actionChooseWeeklyDigest 用快速回覆選星期，每個按鈕都是時間選擇器
+func actionChooseWeeklyDigest(event *linebot.Event, pb *Postback) {
+	if !requireUserChat(event) {
+		return
+	}
+	locale := getLocale(event)
+	buttons := []*linebot.QuickReplyButton{}
+	for weekday := 1; weekday <= 7; weekday++ {
+		label := getWeekdayName(locale, time.Weekday(weekday%7))
+		data := postbackData(&Postback{Action: CodeWeeklyDigest, Weekday: weekday})
+		buttons = append(buttons, linebot.NewQuickReplyButton("",
+			linebot.NewDatetimePickerAction(label, data, datetimePickerModeTime, defaultDigestTime, "", "")))
+	}
+	message := linebot.NewTextMessage(tr(locale, "digest.choose_weekday")).WithQuickReplies(newQuickReplyItems(buttons...))
+	replyMessage(event, message)
+}
+
+func actionSetWeeklyDigest(event *linebot.Event, pb *Postback) {
+	if !requireUserChat(event) {
+		return
+	}
+	clock, ok := getPickedClock(event)
+	if !ok || pb.Weekday < 1 || pb.Weekday > 7 {
+		meta.Log.Println("Invalid weekly digest setting", pb)
+		return
+	}
+	locale := getLocale(event)
+	weekday := time.Weekday(pb.Weekday % 7)
+	digest := &controllers.Digest{UserId: event.Source.UserID}
+	if err := digest.SetWeekly(meta, weekday, clock); err != nil {
+		sendTextMessage(event, tr(locale, "error.setting"))
+		return
+	}
+	sendTextMessage(event, tr(locale, "digest.weekly_set", getWeekdayName(locale, weekday), clock))
+}
+
+func actionCancelDigest(event *linebot.Event, pb *Postback) {
+	if !requireUserChat(event) {
+		return
+	}
+	locale := getLocale(event)
+	digest := &controllers.Digest{UserId: event.Source.UserID}
+	if err := digest.SetDaily(meta, ""); err != nil {
+		sendTextMessage(event, tr(locale, "error.setting"))
+		return
+	}
+	if err := digest.SetWeekly(meta, time.Sunday, ""); err != nil {
+		sendTextMessage(event, tr(locale, "error.setting"))
+		return
+	}
+	sendTextMessage(event, tr(locale, "digest.cancelled"))
+}
+
+func startDigestJob() {
+	runEvery("digest", digestPollInterval, func() {
+		deliverDigests(time.Now())
+	})
+}
+
+// deliverDigests 推播時間已到、今天還沒送過的摘要，並記錄每一筆的結果
+func deliverDigests(now time.Time) {
+	now = now.In(utils.GetTaipeiLocation())
+	date := now.Format("2006-01-02")
+	clock := now.Format("15:04")
+	inactive, err := controllers.GetInactiveUserIds(meta)
+	if err != nil {
+		meta.Log.Println("Unable to get inactive users", err)
+		return
+	}
+	allSettings, err := controllers.GetAllSettings(meta)
+	if err != nil {
+		meta.Log.Println("Unable to get settings, deliver with default settings", err)
+	}
+	for _, kind := range []string{controllers.DigestDaily, controllers.DigestWeekly} {
+		digests, err := controllers.GetDueDigests(meta, kind, date, clock, now.Weekday())
+		if err != nil {
+			meta.Log.Println("Unable to get due digests", kind, err)
+			continue
+		}
+		if len(digests) == 0 {
+			continue
+		}
+		period, altKey := oneDayInSec, "alt.daily_hot"
+		if kind == controllers.DigestWeekly {
+			period, altKey = oneWeekInSec, "alt.weekly_hot"
+		}
+		cache := map[string][]models.ArticleDocument{}
+		for idx := range digests {
+			d := &digests[idx]
+			if ok, err := d.Claim(meta, kind, date); err != nil || !ok {
+				continue
+			}
+			settings := getUserSettings(allSettings, d.UserId)
+			key := getSettingsKey(settings)
+			records, ok := cache[key]
+			if !ok {
+				records, err = controllers.GetMostLike(meta.Collection, getPageSize(settings, maxCountOfCarousel), period, settings.Filter())
+				if err != nil {
+					meta.Log.Println("Unable to get digest articles", kind, err)
+				}
+				sortArticles(records, settings.Order)
+				cache[key] = records
+			}
+			delivery := &controllers.Delivery{UserId: d.UserId, Kind: kind, Date: date, Status: controllers.DeliverySent}
+			if inactive[d.UserId] {
+				delivery.Status, delivery.Error = controllers.DeliverySkipped, "user inactive"
+			} else if settings.NoDigest {
+				delivery.Status, delivery.Error = controllers.DeliverySkipped, "digest paused"
+			} else if len(records) == 0 {
+				delivery.Status, delivery.Error = controllers.DeliverySkipped, "no articles"
+			} else {
+				locale := getSettingsLocale(settings)
+				carousel := &articleCarousel{userId: d.UserId, records: records, locale: locale}
+				if err := pushMessage(d.UserId, renderArticles(carousel, tr(locale, altKey))); err != nil {
+					delivery.Status, delivery.Error = controllers.DeliveryFailed, err.Error()
+				}
+			}
+			delivery.Add(meta)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package bots
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/mong0520/linebot-ptt-beauty/controllers"
+	"github.com/mong0520/linebot-ptt-beauty/utils"
+)
+
+// 匯出、匯入最愛的文字指令，例如「匯出最愛 csv」，沒有指定格式時是 json。指令不分語言都是中文
+const (
+	ExportCommand string = "匯出最愛"
+	ImportCommand string = "匯入最愛"
+	ExportJSON    string = "json"
+	ExportCSV     string = "csv"
+)
+
+// 匯出連結的有效時間
+var exportLinkTTL = 30 * time.Minute
+
+// 匯入檔案的大小與篇數上限
+var maxImportFileSize = 1 << 20
+var maxImportFavorites = 2000
+
+// 匯入檔內容的錯誤，回覆時對應到 importErrorKeys 裡的訊息
+var errImportEmpty = errors.New("import file is empty")
+var errImportNoArticleId = errors.New("import file has no article_id column")
+
+var importErrorKeys = map[error]string{
+	errImportEmpty:       "import.empty",
+	errImportNoArticleId: "import.no_article_id",
+}
+
+var exportCSVHeader = []string{"article_id", "title", "url", "added_at", "note", "collection"}
+
+// getExportURL 產生有時效的下載連結，網址裡只有隨機的 token。網址前綴來自 PublicURL，沒有設定時回傳空字串
+func getExportURL(userId string, format string) (link string, err error) {
+	base := strings.TrimRight(os.Getenv("PublicURL"), "/")
+	if base == "" {
+		return "", nil
+	}
+	exportLink, err := controllers.CreateExportLink(meta, userId, format, exportLinkTTL)
+	if err != nil {
+		return "", err
+	}
+	values := url.Values{}
+	values.Set("t", exportLink.Token)
+	return base + "/export?" + values.Encode(), nil
+}
+
+// exportTextHandler 處理匯出、匯入的文字指令，回傳是否有處理
+func exportTextHandler(event *linebot.Event, message string) bool {
+	fields := strings.Fields(message)
+	if len(fields) == 0 || (fields[0] != ExportCommand && fields[0] != ImportCommand) {
+		return false
+	}
+	locale := getLocale(event)
+	if getGroupId(event.Source) != "" {
+		sendTextMessage(event, tr(locale, "export.private_only"))
+		return true
+	}
+	if fields[0] == ImportCommand {
+		sendTextMessage(event, tr(locale, "import.usage", ExportCommand))
+		return true
+	}
+	format := ExportJSON
+	if len(fields) > 1 {
+		format = strings.ToLower(fields[1])
+	}
+	if format != ExportJSON && format != ExportCSV {
+		sendTextMessage(event, tr(locale, "export.usage", ExportCommand, ExportJSON, ExportCommand, ExportCSV))
+		return true
+	}
+	link, err := getExportURL(event.Source.UserID, format)
+	if err != nil {
+		meta.Log.Println("Unable to create export link", err)
+		sendTextMessage(event, tr(locale, "export.unavailable"))
+		return true
+	}
+	if link == "" {
+		meta.Log.Println("PublicURL is not set, unable to export favorites")
+		sendTextMessage(event, tr(locale, "export.unavailable"))
+		return true
+	}
+	sendTextMessage(event, tr(locale, "export.link", int(exportLinkTTL.Minutes()), link))
+	return true
+}
+
+// exportHandler 提供匯出檔下載，連結不存在或過期時回傳 403
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("t")
+	if token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	link, err := controllers.GetExportLink(meta, token)
+	if err == controllers.ErrExportNotFound {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	} else if err != nil {
+		meta.Log.Println("Unable to get export link", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	format := link.Format
+	records, err := controllers.GetFavoriteExport(meta, link.UserId)
+	if err != nil {
+		meta.Log.Println("Export favorites fail", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"favorites.%s\"", format))
+	if format == ExportJSON {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(records); err != nil {
+			meta.Log.Println("Unable to write export", err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	// 加上 BOM，Excel 才會用 UTF-8 開啟
+	w.Write([]byte("\xEF\xBB\xBF"))
+	writer := csv.NewWriter(w)
+	writer.Write(exportCSVHeader)
+	for _, record := range records {
+		addedAt := ""
+		if !record.AddedAt.IsZero() {
+			addedAt = record.AddedAt.In(utils.GetTaipeiLocation()).Format(time.RFC3339)
+		}
+		writer.Write([]string{record.ArticleId, record.Title, record.URL, addedAt, record.Note, record.Collection})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		meta.Log.Println("Unable to write export", err)
+	}
+}
+
+// fileHandler 匯入使用者傳來的匯出檔，只在一對一聊天處理
+func fileHandler(event *linebot.Event, message *linebot.FileMessage) {
+	if getGroupId(event.Source) != "" {
+		return
+	}
+	locale := getLocale(event)
+	ext := strings.ToLower(path.Ext(message.FileName))
+	if ext != "."+ExportJSON && ext != "."+ExportCSV {
+		sendTextMessage(event, tr(locale, "import.invalid_file", ExportCommand))
+		return
+	}
+	if message.FileSize > maxImportFileSize {
+		sendTextMessage(event, tr(locale, "import.too_large", maxImportFileSize>>10))
+		return
+	}
+	content, err := bot.GetMessageContent(message.ID).Do()
+	if err != nil {
+		meta.Log.Println("Unable to get file content", err)
+		sendTextMessage(event, tr(locale, "import.failed"))
+		return
+	}
+	defer content.Content.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(content.Content, int64(maxImportFileSize)))
+	if err != nil {
+		meta.Log.Println("Unable to read file content", err)
+		sendTextMessage(event, tr(locale, "import.failed"))
+		return
+	}
+
+	var items []controllers.FavoriteExport
+	if ext == "."+ExportJSON {
+		items, err = parseImportJSON(body)
+	} else {
+		items, err = parseImportCSV(body)
+	}
+	if err != nil {
+		if key, ok := importErrorKeys[err]; ok {
+			sendTextMessage(event, tr(locale, "import.invalid_format", tr(locale, key)))
+		} else {
+			sendTextMessage(event, tr(locale, "import.invalid_format", err))
+		}
+		return
+	}
+	if len(items) > maxImportFavorites {
+		sendTextMessage(event, tr(locale, "import.too_many", maxImportFavorites))
+		return
+	}
+	userFavorite := &controllers.UserFavorite{UserId: event.Source.UserID}
+	result, err := userFavorite.ImportFavorites(meta, items, maxCollections)
+	if err != nil {
+		sendTextMessage(event, tr(locale, "import.partial", result.Added))
+		return
+	}
+	text := tr(locale, "import.done", result.Added, result.Existed)
+	if result.Missing > 0 {
+		text += tr(locale, "import.missing", result.Missing)
+	}
+	sendTextMessage(event, text)
+}
+
+func parseImportJSON(body []byte) (items []controllers.FavoriteExport, err error) {
+	records := []controllers.FavoriteExport{}
+	if err := json.Unmarshal(body, &records); err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, record := range records {
+		items = appendImportItem(items, seen, record.ArticleId, record.AddedAt, record.Note, record.Collection)
+	}
+	return items, nil
+}
+
+func parseImportCSV(body []byte) (items []controllers.FavoriteExport, err error) {
+	rows, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(string(body), "\xEF\xBB\xBF"))).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errImportEmpty
+	}
+	columns := map[string]int{}
+	for idx, name := range rows[0] {
+		columns[strings.TrimSpace(name)] = idx
+	}
+	if _, ok := columns["article_id"]; !ok {
+		return nil, errImportNoArticleId
+	}
+	get := func(row []string, name string) string {
+		if idx, ok := columns[name]; ok && idx < len(row) {
+			return strings.TrimSpace(row[idx])
+		}
+		return ""
+	}
+	seen := map[string]bool{}
+	for _, row := range rows[1:] {
+		addedAt, _ := time.Parse(time.RFC3339, get(row, "added_at"))
+		items = appendImportItem(items, seen, get(row, "article_id"), addedAt, get(row, "note"), get(row, "collection"))
+	}
+	return items, nil
+}
+
+// appendImportItem 略過空白與重複的文章，備註與收藏夾名稱超過長度時截斷
+func appendImportItem(items []controllers.FavoriteExport, seen map[string]bool, articleId string, addedAt time.Time, note string, collection string) []controllers.FavoriteExport {
+	articleId = strings.TrimSpace(articleId)
+	if articleId == "" || seen[articleId] {
+		return items
+	}
+	seen[articleId] = true
+	return append(items, controllers.FavoriteExport{
+		ArticleId:  articleId,
+		AddedAt:    addedAt,
+		Note:       utils.TruncateRunes(strings.TrimSpace(note), maxFavoriteNoteLength),
+		Collection: utils.TruncateRunes(strings.TrimSpace(collection), maxCollectionNameLength),
+	})
+}
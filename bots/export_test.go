@@ -0,0 +1,71 @@
+package bots
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mong0520/linebot-ptt-beauty/controllers"
+)
+
+func TestParseImport(t *testing.T) {
+	addedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	longName := strings.Repeat("長", maxCollectionNameLength+5)
+	want := []controllers.FavoriteExport{
+		{ArticleId: "M.1.A.1", AddedAt: addedAt, Note: "備註", Collection: "長髮"},
+		{ArticleId: "M.2.A.2", Collection: strings.Repeat("長", maxCollectionNameLength-1) + "…"},
+	}
+	tests := []struct {
+		name  string
+		parse func([]byte) ([]controllers.FavoriteExport, error)
+		body  string
+	}{
+		{"json", parseImportJSON, `[
+			{"article_id": "M.1.A.1", "added_at": "2024-01-02T03:04:05Z", "note": " 備註 ", "collection": "長髮"},
+			{"article_id": "M.1.A.1", "note": "重複的略過"},
+			{"article_id": " "},
+			{"article_id": "M.2.A.2", "collection": "` + longName + `"}
+		]`},
+		{"csv with bom", parseImportCSV, "\xEF\xBB\xBFarticle_id,title,url,added_at,note,collection\n" +
+			"M.1.A.1,t,u,2024-01-02T03:04:05Z,備註,長髮\n" +
+			"M.1.A.1,t,u,,重複的略過,\n" +
+			",t,u,,,\n" +
+			"M.2.A.2,t,u,not-a-time,," + longName + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := tt.parse([]byte(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(items, want) {
+				t.Errorf("items = %+v, want %+v", items, want)
+			}
+		})
+	}
+}
+
+func TestParseImportCSVErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		// want 為 nil 時只檢查有錯誤
+		want error
+	}{
+		{"empty", "", errImportEmpty},
+		{"missing article_id column", "title,url\nt,u\n", errImportNoArticleId},
+		{"broken quote", "article_id\n\"M.1.A.1\n", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseImportCSV([]byte(tt.body))
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if tt.want != nil && err != tt.want {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
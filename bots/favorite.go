@@ -0,0 +1,110 @@
+package bots
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/mong0520/linebot-ptt-beauty/controllers"
+)
+
+// FavoriteNoteCommand 替最後加入的最愛加上備註，例如「備註 超像新垣結衣」，只輸入「備註」會清除。
+// 其他語言的提示也是請使用者輸入這個中文指令
+const FavoriteNoteCommand string = "備註"
+
+var maxFavoriteNoteLength = 30
+
+// favoriteSortOptions 的 key 是訊息目錄裡的按鈕名稱
+var favoriteSortOptions = []struct {
+	key  string
+	sort string
+}{
+	{"favorite.sort_added", controllers.FavoriteSortAdded},
+	{"favorite.sort_push", controllers.FavoriteSortPush},
+	{"favorite.sort_date", controllers.FavoriteSortDate},
+}
+
+// getFavorites 取出事件來源的最愛 (依加入順序) 與備註，群組裡是群組共用的最愛；
+// collectionId 不為空時只取該收藏夾
+func getFavorites(event *linebot.Event, collectionId string) (articleIds []string, notes map[string]string) {
+	notes = map[string]string{}
+	if getGroupId(event.Source) != "" {
+		if group := getGroup(event); group != nil {
+			return group.FavoriteIds(), notes
+		}
+		return []string{}, notes
+	}
+	userData, err := getUserFavorite(event.Source.UserID)
+	if err != nil || userData == nil {
+		return []string{}, notes
+	}
+	for _, f := range userData.Favorites {
+		if f.Note != "" {
+			notes[f.ArticleId] = "📝 " + f.Note
+		}
+	}
+	if collectionId != "" {
+		if collection := userData.GetCollection(collectionId); collection != nil {
+			return collection.Articles, notes
+		}
+		return []string{}, notes
+	}
+	return userData.FavoriteIds(), notes
+}
+
+// getFavoriteSortButtons 產生切換排序的快速回覆，目前的排序不列出
+func getFavoriteSortButtons(pb *Postback, locale string) []*linebot.QuickReplyButton {
+	current := pb.Sort
+	if current == "" {
+		current = controllers.FavoriteSortAdded
+	}
+	buttons := []*linebot.QuickReplyButton{}
+	for _, option := range favoriteSortOptions {
+		if option.sort == current {
+			continue
+		}
+		label := tr(locale, option.key)
+		data := postbackData(&Postback{Action: CodeShowFavorite, Collection: pb.Collection, Sort: option.sort})
+		buttons = append(buttons, linebot.NewQuickReplyButton("",
+			linebot.NewPostbackAction(label, data, "", label)))
+	}
+	return buttons
+}
+
+// favoriteTextHandler 處理最愛的文字指令，回傳是否有處理
+func favoriteTextHandler(event *linebot.Event, message string) bool {
+	fields := strings.Fields(message)
+	if len(fields) == 0 || fields[0] != FavoriteNoteCommand {
+		return false
+	}
+	locale := getLocale(event)
+	if getGroupId(event.Source) != "" {
+		sendTextMessage(event, tr(locale, "note.group"))
+		return true
+	}
+	note := strings.Join(fields[1:], " ")
+	if utf8.RuneCountInString(note) > maxFavoriteNoteLength {
+		sendTextMessage(event, tr(locale, "note.too_long", maxFavoriteNoteLength))
+		return true
+	}
+	userData, err := getUserFavorite(event.Source.UserID)
+	if err != nil {
+		sendTextMessage(event, tr(locale, "error.setting"))
+		return true
+	}
+	latest := userData.LatestFavorite()
+	if latest == nil {
+		sendTextMessage(event, tr(locale, "note.no_favorite"))
+		return true
+	}
+	if err := userData.SetNote(meta, latest.ArticleId, note); err != nil {
+		sendTextMessage(event, tr(locale, "error.setting"))
+		return true
+	}
+	if note == "" {
+		sendTextMessage(event, tr(locale, "note.cleared"))
+	} else {
+		sendTextMessage(event, tr(locale, "note.set", note))
+	}
+	return true
+}
@@ -0,0 +1,173 @@
+package bots
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/mong0520/linebot-ptt-beauty/models"
+	"github.com/mong0520/linebot-ptt-beauty/utils"
+)
+
+var flexBadgeColor = "#E91E63"
+var flexSubTextColor = "#999999"
+
+func getFlexCarousel(carousel *articleCarousel) (container *linebot.CarouselContainer) {
+	favorites := carousel.favoriteSet()
+	bubbles := []*linebot.BubbleContainer{}
+	for _, record := range carousel.records {
+		bubbles = append(bubbles, getArticleBubble(record, favorites[record.ArticleID], carousel.notes[record.ArticleID], carousel.locale))
+	}
+	if carousel.nav != nil {
+		bubbles = append(bubbles, getNavBubble(carousel.nav, carousel.locale))
+	}
+	return &linebot.CarouselContainer{
+		Type:     linebot.FlexContainerTypeCarousel,
+		Contents: bubbles,
+	}
+}
+
+func getArticleBubble(record models.ArticleDocument, isFavorite bool, note string, locale string) *linebot.BubbleContainer {
+	thumnailUrl := defaultImage
+	if len(record.ImageLinks) > 0 {
+		thumnailUrl = record.ImageLinks[0]
+	}
+	category, title := utils.SplitArticleTitle(record.ArticleTitle)
+	// Flex 的文字不能是空的，只有分類的標題 (例如「[正妹]」) 顯示完整標題
+	if strings.TrimSpace(title) == "" {
+		title = record.ArticleTitle
+	}
+	if strings.TrimSpace(title) == "" {
+		title = "--"
+	}
+	date := "--"
+	if record.Timestamp > 0 {
+		date = time.Unix(int64(record.Timestamp), 0).In(utils.GetTaipeiLocation()).Format("2006/01/02")
+	}
+	favLabel := actionLabel(CodeFavoriteAdd, locale)
+	if isFavorite {
+		favLabel = actionLabel(CodeFavoriteRemove, locale)
+	}
+	counts := fmt.Sprintf("%d 😍  %d 😡", record.MessageCount.Push, record.MessageCount.Boo)
+	if note != "" {
+		counts = fmt.Sprintf("%s  %s", counts, note)
+	}
+
+	previewData := postbackData(&Postback{Action: CodeAllImage, ArticleID: record.ArticleID})
+	favoriteData := getFavoritePostback(record.ArticleID, isFavorite)
+	moreData := postbackData(&Postback{Action: CodeMore, ArticleID: record.ArticleID})
+
+	return &linebot.BubbleContainer{
+		Type: linebot.FlexContainerTypeBubble,
+		Hero: &linebot.ImageComponent{
+			Type:        linebot.FlexComponentTypeImage,
+			URL:         thumnailUrl,
+			Size:        linebot.FlexImageSizeTypeFull,
+			AspectRatio: linebot.FlexImageAspectRatioType20to13,
+			AspectMode:  linebot.FlexImageAspectModeTypeCover,
+			Action:      linebot.NewURIAction(tr(locale, "card.click"), record.URL),
+		},
+		Body: &linebot.BoxComponent{
+			Type:    linebot.FlexComponentTypeBox,
+			Layout:  linebot.FlexBoxLayoutTypeVertical,
+			Spacing: linebot.FlexComponentSpacingTypeSm,
+			Contents: []linebot.FlexComponent{
+				&linebot.BoxComponent{
+					Type:   linebot.FlexComponentTypeBox,
+					Layout: linebot.FlexBoxLayoutTypeBaseline,
+					Contents: []linebot.FlexComponent{
+						&linebot.TextComponent{
+							Type:   linebot.FlexComponentTypeText,
+							Text:   category,
+							Size:   linebot.FlexTextSizeTypeXs,
+							Weight: linebot.FlexTextWeightTypeBold,
+							Color:  flexBadgeColor,
+						},
+						&linebot.TextComponent{
+							Type:  linebot.FlexComponentTypeText,
+							Text:  date,
+							Size:  linebot.FlexTextSizeTypeXs,
+							Color: flexSubTextColor,
+							Align: linebot.FlexComponentAlignTypeEnd,
+						},
+					},
+				},
+				&linebot.TextComponent{
+					Type:   linebot.FlexComponentTypeText,
+					Text:   title,
+					Size:   linebot.FlexTextSizeTypeMd,
+					Weight: linebot.FlexTextWeightTypeBold,
+					Wrap:   true,
+				},
+				&linebot.TextComponent{
+					Type: linebot.FlexComponentTypeText,
+					Text: counts,
+					Size: linebot.FlexTextSizeTypeSm,
+				},
+				&linebot.TextComponent{
+					Type:  linebot.FlexComponentTypeText,
+					Text:  fmt.Sprintf("✍️ %s", record.Author),
+					Size:  linebot.FlexTextSizeTypeXs,
+					Color: flexSubTextColor,
+				},
+			},
+		},
+		Footer: &linebot.BoxComponent{
+			Type:    linebot.FlexComponentTypeBox,
+			Layout:  linebot.FlexBoxLayoutTypeVertical,
+			Spacing: linebot.FlexComponentSpacingTypeSm,
+			Contents: []linebot.FlexComponent{
+				getFlexButton(linebot.NewPostbackAction(fmt.Sprintf("%s (%d)", actionLabel(CodeAllImage, locale), len(record.ImageLinks)), previewData, "", "")),
+				getFlexButton(linebot.NewPostbackAction(favLabel, favoriteData, "", "")),
+				getFlexButton(linebot.NewPostbackAction(actionLabel(CodeMore, locale), moreData, "", "")),
+			},
+		},
+	}
+}
+
+func getNavBubble(nav *pageNav, locale string) *linebot.BubbleContainer {
+	helpLabel := actionLabel(CodeHelp, locale)
+	buttons := []linebot.FlexComponent{
+		getFlexButton(linebot.NewMessageAction(helpLabel, helpLabel)),
+		getFlexButton(linebot.NewPostbackAction(nav.previousText(locale), nav.previousData, "", "")),
+	}
+	if nav.nextData != "" {
+		buttons = append(buttons, getFlexButton(linebot.NewPostbackAction(nav.nextText(locale), nav.nextData, "", "")))
+	}
+	return &linebot.BubbleContainer{
+		Type: linebot.FlexContainerTypeBubble,
+		Body: &linebot.BoxComponent{
+			Type:   linebot.FlexComponentTypeBox,
+			Layout: linebot.FlexBoxLayoutTypeVertical,
+			Contents: []linebot.FlexComponent{
+				&linebot.TextComponent{
+					Type:   linebot.FlexComponentTypeText,
+					Text:   tr(locale, "title"),
+					Size:   linebot.FlexTextSizeTypeLg,
+					Weight: linebot.FlexTextWeightTypeBold,
+				},
+				&linebot.TextComponent{
+					Type: linebot.FlexComponentTypeText,
+					Text: tr(locale, "nav.more"),
+					Size: linebot.FlexTextSizeTypeSm,
+				},
+			},
+		},
+		Footer: &linebot.BoxComponent{
+			Type:     linebot.FlexComponentTypeBox,
+			Layout:   linebot.FlexBoxLayoutTypeVertical,
+			Spacing:  linebot.FlexComponentSpacingTypeSm,
+			Contents: buttons,
+		},
+	}
+}
+
+func getFlexButton(action linebot.TemplateAction) *linebot.ButtonComponent {
+	return &linebot.ButtonComponent{
+		Type:   linebot.FlexComponentTypeButton,
+		Action: action,
+		Style:  linebot.FlexButtonStyleTypeLink,
+		Height: linebot.FlexButtonHeightTypeSm,
+	}
+}
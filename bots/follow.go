@@ -0,0 +1,68 @@
+package bots
+
+import (
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/mong0520/linebot-ptt-beauty/controllers"
+	"github.com/mong0520/linebot-ptt-beauty/utils"
+)
+
+// eventHandler 處理訊息與 postback 以外的事件
+func eventHandler(event *linebot.Event) {
+	switch event.Type {
+	case linebot.EventTypeFollow:
+		followHandler(event)
+	case linebot.EventTypeUnfollow:
+		unfollowHandler(event)
+	case linebot.EventTypeJoin:
+		joinHandler(event)
+	case linebot.EventTypeLeave:
+		leaveHandler(event)
+	default:
+		meta.Log.Printf("got a %s event\n", event.Type)
+	}
+}
+
+// followHandler 加入好友或解除封鎖時建立使用者記錄，並送上歡迎訊息與選單
+func followHandler(event *linebot.Event) {
+	meta.Log.Printf("User (%s) follows\n", utils.RedactID(event.Source.UserID))
+	userFavorite := &controllers.UserFavorite{UserId: event.Source.UserID}
+	if err := userFavorite.Follow(meta); err != nil {
+		meta.Log.Println("Unable to create user", err)
+	}
+	locale := getLocale(event)
+	template := getMenuButtonTemplateV2(locale)
+	replyMessage(event,
+		linebot.NewTextMessage(tr(locale, "welcome", tr(locale, "title"), getSearchTips(locale))),
+		linebot.NewTemplateMessage(tr(locale, "menu.alt"), template).WithQuickReplies(getQuickReplyItems(event, nil)),
+	)
+}
+
+// unfollowHandler 使用者封鎖機器人後沒有 reply token，只能記錄下來停止推播
+func unfollowHandler(event *linebot.Event) {
+	meta.Log.Printf("User (%s) unfollows\n", utils.RedactID(event.Source.UserID))
+	userFavorite := &controllers.UserFavorite{UserId: event.Source.UserID}
+	if err := userFavorite.Unfollow(meta); err != nil {
+		meta.Log.Println("Unable to mark user inactive", err)
+	}
+}
+
+func joinHandler(event *linebot.Event) {
+	groupId := getGroupId(event.Source)
+	meta.Log.Printf("Join group (%s)\n", utils.RedactID(groupId))
+	group := &controllers.Group{GroupId: groupId}
+	if err := group.Join(meta); err != nil {
+		meta.Log.Println("Unable to create group", err)
+	}
+	locale := getLocale(event)
+	sendTextMessage(event, tr(locale, "group.welcome",
+		tr(locale, "title"), groupTriggerPrefix, groupTriggerPrefix, groupTriggerPrefix, GroupCommandDisable))
+}
+
+func leaveHandler(event *linebot.Event) {
+	groupId := getGroupId(event.Source)
+	meta.Log.Printf("Leave group (%s)\n", utils.RedactID(groupId))
+	group := &controllers.Group{GroupId: groupId}
+	if err := group.Leave(meta); err != nil {
+		meta.Log.Println("Unable to mark group left", err)
+	}
+}
@@ -0,0 +1,176 @@
+package bots
+
+import (
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/mong0520/linebot-ptt-beauty/controllers"
+	"github.com/mong0520/linebot-ptt-beauty/utils"
+)
+
+// 群組裡只處理以這個前綴開頭的訊息，可用環境變數 GroupTriggerPrefix 修改
+var groupTriggerPrefix = "@表特"
+
+// 群組設定指令，接在前綴後面，例如「@表特 關閉」。群組一律使用繁體中文，指令也只有中文
+const (
+	GroupCommandEnable   string = "開啟"
+	GroupCommandDisable  string = "關閉"
+	GroupCommandCategory string = "分類"
+	GroupCommandStatus   string = "設定"
+	GroupCategoryDefault string = "預設"
+)
+
+var maxGroupCategories = 5
+var maxGroupCategoryLength = 10
+
+func initGroupTriggerPrefix() {
+	if prefix := strings.TrimSpace(os.Getenv("GroupTriggerPrefix")); prefix != "" {
+		groupTriggerPrefix = prefix
+	}
+	meta.Log.Printf("Group Trigger Prefix = %s\n", groupTriggerPrefix)
+}
+
+// getGroupId 回傳群組或多人聊天室的 id，一對一聊天時為空字串
+func getGroupId(source *linebot.EventSource) string {
+	if source.GroupID != "" {
+		return source.GroupID
+	}
+	return source.RoomID
+}
+
+// getGroup 取出事件來源的群組設定，一對一聊天或查詢失敗時回傳 nil
+func getGroup(event *linebot.Event) *controllers.Group {
+	groupId := getGroupId(event.Source)
+	if groupId == "" {
+		return nil
+	}
+	group := &controllers.Group{GroupId: groupId}
+	result, err := group.Get(meta)
+	if err != nil {
+		return nil
+	}
+	return result
+}
+
+// getCategories 回傳查詢時要限制的分類，沒有限制時為 nil
+func getCategories(event *linebot.Event) []string {
+	if group := getGroup(event); group != nil {
+		return group.Categories
+	}
+	return nil
+}
+
+// isGroupDisabled 群組關閉時不回應任何 postback
+func isGroupDisabled(event *linebot.Event) bool {
+	group := getGroup(event)
+	return group != nil && group.Disabled
+}
+
+// getMemberName 取得事件發送者的名稱，群組成員不一定是好友所以要用群組的 API 查
+func getMemberName(source *linebot.EventSource) string {
+	var res *linebot.UserProfileResponse
+	var err error
+	switch {
+	case source.GroupID != "":
+		res, err = bot.GetGroupMemberProfile(source.GroupID, source.UserID).Do()
+	case source.RoomID != "":
+		res, err = bot.GetRoomMemberProfile(source.RoomID, source.UserID).Do()
+	default:
+		return getUserNameById(source.UserID)
+	}
+	if err != nil {
+		return tr(defaultLocale, "group.someone")
+	}
+	return res.DisplayName
+}
+
+// groupTextHandler 處理群組裡的訊息，回傳去掉前綴後要繼續處理的文字。
+// 沒有前綴、設定指令或群組已關閉時回傳 false
+func groupTextHandler(event *linebot.Event, message string) (string, bool) {
+	if !strings.HasPrefix(message, groupTriggerPrefix) {
+		return "", false
+	}
+	message = strings.TrimSpace(strings.TrimPrefix(message, groupTriggerPrefix))
+	group := getGroup(event)
+	if group == nil {
+		return "", false
+	}
+
+	locale := getLocale(event)
+	fields := strings.Fields(message)
+	if len(fields) > 0 {
+		switch fields[0] {
+		case GroupCommandEnable, GroupCommandDisable:
+			disabled := fields[0] == GroupCommandDisable
+			if err := group.SetDisabled(meta, disabled, event.Source.UserID); err != nil {
+				sendTextMessage(event, tr(locale, "error.setting"))
+				return "", false
+			}
+			meta.Log.Printf("Group [%s] disabled = %t by User (%s)\n", utils.RedactID(group.GroupId), disabled, utils.RedactID(event.Source.UserID))
+			// 每個成員都能修改群組設定，所以告訴大家是誰改的
+			name := getMemberName(event.Source)
+			if disabled {
+				sendTextMessage(event, tr(locale, "group.disabled", name, groupTriggerPrefix, GroupCommandEnable))
+			} else {
+				sendTextMessage(event, tr(locale, "group.enabled", name))
+			}
+			return "", false
+		case GroupCommandCategory:
+			setGroupCategories(event, group, fields[1:])
+			return "", false
+		case GroupCommandStatus:
+			sendTextMessage(event, getGroupStatus(group, locale))
+			return "", false
+		}
+	}
+	if group.Disabled {
+		return "", false
+	}
+	if message == "" {
+		message = ActionHelp
+	}
+	return message, true
+}
+
+func setGroupCategories(event *linebot.Event, group *controllers.Group, categories []string) {
+	locale := getLocale(event)
+	if len(categories) == 0 {
+		sendTextMessage(event, tr(locale, "group.category_usage",
+			groupTriggerPrefix, GroupCommandCategory, groupTriggerPrefix, GroupCommandCategory, GroupCategoryDefault))
+		return
+	}
+	if len(categories) == 1 && categories[0] == GroupCategoryDefault {
+		categories = []string{}
+	}
+	if len(categories) > maxGroupCategories {
+		sendTextMessage(event, tr(locale, "group.too_many_categories", maxGroupCategories))
+		return
+	}
+	for _, category := range categories {
+		if utf8.RuneCountInString(category) > maxGroupCategoryLength {
+			sendTextMessage(event, tr(locale, "group.category_too_long", category))
+			return
+		}
+	}
+	if err := group.SetCategories(meta, categories, event.Source.UserID); err != nil {
+		sendTextMessage(event, tr(locale, "error.setting"))
+		return
+	}
+	meta.Log.Printf("Group [%s] categories = %v by User (%s)\n", utils.RedactID(group.GroupId), categories, utils.RedactID(event.Source.UserID))
+	group.Categories = categories
+	sendTextMessage(event, tr(locale, "group.categories_changed", getMemberName(event.Source))+"\n"+getGroupStatus(group, locale))
+}
+
+func getGroupStatus(group *controllers.Group, locale string) string {
+	status := tr(locale, "group.status_enabled")
+	if group.Disabled {
+		status = tr(locale, "group.status_disabled")
+	}
+	categories := tr(locale, "group.default_categories", GroupCategoryDefault)
+	if len(group.Categories) > 0 {
+		categories = strings.Join(group.Categories, tr(locale, "list.separator"))
+	}
+	return tr(locale, "group.status", status, categories, len(group.Favorites))
+}
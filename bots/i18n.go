@@ -0,0 +1,719 @@
+package bots
+
+import (
+	"fmt"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/mong0520/linebot-ptt-beauty/controllers"
+)
+
+// 沒有設定語言或不支援的語言都使用繁體中文
+var defaultLocale = controllers.LanguageZhTW
+
+// catalog 是各語言的訊息目錄，key 與 postback 的動作代碼無關，改翻譯不會影響路由。
+// 動作按鈕的名稱用 "label.<代碼>"、選單說明用 "help.<代碼>"，繁體中文直接取自 Route，
+// 其他語言缺少的訊息會退回繁體中文。
+// 選單名稱以外的文字指令 (分享收藏夾、訂閱、刪除我的資料…) 只有中文，其他語言的說明裡也照樣引用中文指令
+var catalog = map[string]map[string]string{
+	controllers.LanguageZhTW: {
+		"title":          DefaultTitle,
+		"menu.alt":       "我能為您做什麼？",
+		"list.separator": "、",
+		"nav.more":       "繼續看？",
+		"nav.previous":   "上一頁 %d",
+		"nav.next":       "下一頁 %d",
+		"nav.next_image": "下一頁",
+		"card.click":     ActionClick,
+		"search_tips":    "直接輸入關鍵字就會幫您搜尋文章標題，例如輸入「新垣結衣」\n輸入「%s」可以打開功能選單",
+		"welcome":        "感謝加入%s！\n%s",
+
+		"alt.query":        "已幫您查詢到一些照片~",
+		"alt.random":       "隨機表特已送到囉",
+		"alt.newest":       "熱騰騰的最新照片送到了!",
+		"alt.favorites":    "最愛照片已送達",
+		"alt.preview":      "預覽圖片已送達",
+		"alt.on_this_day":  "歷史上的今天送到囉",
+		"alt.subscription": "您訂閱的表特有新文章",
+		"alt.daily_hot":    "本日熱門送到囉",
+		"alt.weekly_hot":   "本週熱門送到囉",
+
+		"error.query":     "查詢失敗，請稍後再試",
+		"error.setting":   "設定失敗，請稍後再試",
+		"article.missing": "找不到這篇文章，可能已經被刪除了",
+
+		"favorite.added":         "已新增至最愛，輸入「%s 文字」可以加上備註",
+		"favorite.removed":       "已從最愛中移除",
+		"favorite.empty":         "還沒有最愛，看到喜歡的照片按「%s」就會收進來",
+		"favorite.sort_added":    "🕒 依加入時間",
+		"favorite.sort_push":     "😍 依推文數",
+		"favorite.sort_date":     "📅 依文章日期",
+		"group.favorite_added":   "%s 已新增至群組最愛",
+		"group.favorite_removed": "%s 已從群組最愛中移除",
+
+		"on_this_day.empty":        "往年的今天沒有找到照片 QQ",
+		"on_this_day.subscribed":   "之後每天都會推播歷史上的今天給您",
+		"on_this_day.unsubscribed": "已取消歷史上的今天推播",
+
+		"settings.title":   "⚙️ 您的設定",
+		"settings.updated": "✅ 設定已更新",
+		"settings.choose":  "請選擇%s",
+		"settings.group":   "群組請輸入「%s %s」查看群組設定",
+
+		"share.usage":           "請輸入「%s 分享碼」",
+		"share.private_only":    "請私訊機器人管理分享",
+		"share.all_favorites":   "全部最愛",
+		"share.collection_name": "「%s」",
+		"share.not_shared":      "%s還沒有分享過",
+		"share.revoked":         "%s的分享碼已失效",
+		"share.created":         "🔗 %s的分享碼：%s\n朋友私訊機器人輸入「%s %s」就能瀏覽，看到的會是您目前的收藏",
+		"share.link":            "或是直接點開：%s",
+		"share.revoke_hint":     "輸入「%s」可以讓分享碼失效",
+		"share.not_found":       "分享碼 %s 不存在或已經失效",
+		"share.copied":          "已加入 %d 篇到您的最愛，原本就有的 %d 篇略過",
+		"alt.share":             "分享的最愛送到囉",
+		"alt.share_collection":  "分享的收藏夾「%s」送到囉",
+
+		"collection.tips":            "輸入「%s 名稱」建立收藏夾\n「%s 舊名稱 新名稱」改名\n「%s 名稱」刪除，裡面的文章會變成未分類\n「%s 名稱」產生分享碼給朋友",
+		"collection.title":           "📁 您的收藏夾",
+		"collection.all":             CollectionAll,
+		"collection.none":            CollectionNone,
+		"collection.private_only":    "收藏夾請私訊我設定",
+		"collection.invalid_name":    "收藏夾名稱最多 %d 個字，也不能叫「%s」或「%s」",
+		"collection.too_many":        "最多只能建立 %d 個收藏夾",
+		"collection.exists":          "已經有「%s」收藏夾了",
+		"collection.created":         "已建立「%s」收藏夾，加入最愛時可以選擇放進去",
+		"collection.not_found":       "找不到「%s」收藏夾",
+		"collection.renamed":         "「%s」已改名為「%s」",
+		"collection.deleted":         "已刪除「%s」，裡面的 %d 篇文章變成%s",
+		"collection.create_hint":     "輸入「%s 名稱」可以分類收藏",
+		"collection.choose":          "選擇收藏夾",
+		"collection.choose_suffix":   "，要放進哪個收藏夾？",
+		"collection.deleted_already": "這個收藏夾已經被刪除了",
+		"collection.moved":           "已移到「%s」",
+		"collection.empty":           "這個收藏夾目前是空的",
+
+		"note.group":       "群組最愛不支援備註",
+		"note.too_long":    "備註最多 %d 個字",
+		"note.no_favorite": "還沒有最愛可以加備註",
+		"note.cleared":     "已清除最新一篇最愛的備註",
+		"note.set":         "已替最新一篇最愛加上備註：%s",
+
+		"subscription.tips":         "輸入「%s 關鍵字」、「%s %s 作者id」或「%s %s 分類」訂閱新文章通知\n輸入「%s 23:00-08:00」設定勿擾時段，「%s %s」取消",
+		"subscription.private_only": "訂閱通知請私訊我設定",
+		"subscription.added":        "已訂閱「%s」，有新文章會通知您",
+		"subscription.removed":      "已取消訂閱「%s」",
+		"subscription.too_long":     "訂閱的文字最多 %d 個字",
+		"subscription.too_many":     "最多只能訂閱 %d 項，請先取消一些",
+		"subscription.quiet_off":    "已取消勿擾時段",
+		"subscription.quiet_set":    "%s 到 %s 之間的通知會延到之後再送",
+		"subscription.empty":        "您還沒有訂閱任何通知",
+		"subscription.title":        "您訂閱了：",
+		"subscription.cancel":       "取消 %s",
+		"subscription.quiet_hours":  "勿擾時段：%s-%s",
+
+		"weekday.0":             "週日",
+		"weekday.1":             "週一",
+		"weekday.2":             "週二",
+		"weekday.3":             "週三",
+		"weekday.4":             "週四",
+		"weekday.5":             "週五",
+		"weekday.6":             "週六",
+		"digest.private_only":   "熱門摘要請私訊我設定",
+		"digest.description":    "在您選的時間 (台灣時間) 推播熱門文章",
+		"digest.daily_status":   "每日 %s",
+		"digest.weekly_status":  "每%s %s",
+		"digest.status":         "目前訂閱：%s",
+		"digest.none":           "還沒有訂閱熱門摘要",
+		"digest.paused":         "⏸ 已在個人設定暫停",
+		"digest.daily_set":      "之後每天 %s 會推播本日熱門給您",
+		"digest.weekly_set":     "之後每%s %s 會推播本週熱門給您",
+		"digest.choose_weekday": "每週哪一天推播本週熱門？",
+		"digest.cancelled":      "已取消熱門摘要",
+
+		"export.private_only":   "請私訊機器人匯出或匯入最愛",
+		"export.usage":          "請輸入「%s %s」或「%s %s」",
+		"export.unavailable":    "目前無法匯出，請稍後再試",
+		"export.link":           "📦 最愛的下載連結，%d 分鐘內有效，請勿分享給別人：\n%s",
+		"import.usage":          "把「%s」下載的 .json 或 .csv 檔案直接傳到這裡就會匯入，已經在最愛裡的文章會略過",
+		"import.invalid_file":   "只能匯入「%s」下載的 .json 或 .csv 檔案",
+		"import.too_large":      "檔案太大了，最多 %d KB",
+		"import.failed":         "匯入失敗，請稍後再試",
+		"import.invalid_format": "檔案格式不正確：%v",
+		"import.empty":          "沒有內容",
+		"import.no_article_id":  "缺少 article_id 欄位",
+		"import.too_many":       "一次最多匯入 %d 篇",
+		"import.partial":        "匯入到一半失敗了，已匯入 %d 篇，請稍後再試一次",
+		"import.done":           "已匯入 %d 篇到您的最愛，原本就有的 %d 篇略過",
+		"import.missing":        "，另外 %d 篇原文已不存在，沒有匯入",
+
+		"privacy.private_only": "請私訊機器人刪除資料",
+		"privacy.confirm":      "確定要刪除您的最愛、收藏夾與分享、新文章通知、熱門摘要與各項設定嗎？刪除後無法復原。\n\n不刪除的話忽略這則訊息就好",
+		"privacy.failed":       "刪除失敗，請稍後再試",
+		"privacy.deleted":      "您的資料已經全部刪除了，之後再使用最愛等功能會重新開始記錄",
+
+		"comments.empty":             "這篇文章還沒有人推文",
+		"comments.remaining":         "還有 %d 則推文",
+		"comments.next":              "下一頁",
+		"alt.more_comments":          "還有更多推文",
+		"summary.images_only":        "這篇文章只有圖片，沒有其他內容",
+		"orphan.title":               "[已刪除] 原文已不存在",
+		"orphan.note":                "⚠️ 之後會自動從最愛移除",
+		"leaderboard.pending":        "排行榜還在計算中，請稍後再試",
+		"leaderboard.favorite_count": "%d 人收藏",
+		"leaderboard.author_stats":   "%d 😍\t%d 篇文章",
+		"leaderboard.empty":          "沒有符合設定的文章，可以在設定裡調整分類或安全模式",
+		"alt.top_favorite":           "最愛排行送到囉",
+		"alt.weekly_top_favorite":    "本週最愛送到囉",
+		"alt.top_author":             "作者排行送到囉",
+		"alt.author":                 "%s 的文章送到囉",
+
+		"group.someone":             "有人",
+		"group.welcome":             "大家好，我是%s！\n在訊息前面加上「%s」就能呼叫我，例如「%s 新垣結衣」\n輸入「%s %s」可以讓我暫時安靜",
+		"group.enabled":             "%s 開啟了表特看看",
+		"group.disabled":            "%s 關閉了表特看看，輸入「%s %s」可以重新開啟",
+		"group.categories_changed":  "%s 修改了群組分類",
+		"group.category_usage":      "用法：%s %s 正妹 帥哥，或 %s %s %s",
+		"group.too_many_categories": "最多只能設定 %d 個分類",
+		"group.category_too_long":   "分類「%s」太長了",
+		"group.status":              "狀態：%s\n分類：%s\n群組最愛：%d 篇",
+		"group.status_enabled":      "開啟",
+		"group.status_disabled":     "關閉",
+		"group.default_categories":  "%s (正妹)",
+	},
+	controllers.LanguageEn: {
+		"title":          "💋 PTT Beauty",
+		"menu.alt":       "What can I do for you?",
+		"list.separator": ", ",
+		"nav.more":       "See more?",
+		"nav.previous":   "Prev %d",
+		"nav.next":       "Next %d",
+		"nav.next_image": "Next",
+		"card.click":     "👉 Open",
+		"search_tips":    "Type any keyword to search article titles, e.g. 「新垣結衣」\nType 「%s」 to open the menu",
+		"welcome":        "Thanks for adding %s!\n%s",
+
+		"label.mn": "📖 Menu",
+		"label.st": "🔍 Search tips",
+		"label.nw": "🎊 Newest",
+		"label.rd": "👩 Random 10",
+		"label.fl": "❤️ My favorites",
+		"label.cs": "📁 Collections",
+		"label.hd": "📈 Today's hot",
+		"label.hm": "🔥 Trending",
+		"label.hy": "🏆 Best of year",
+		"label.od": "📅 On this day",
+		"label.os": "🔔 Daily push",
+		"label.ou": "🔕 Stop push",
+		"label.tw": "🏅 Weekly top",
+		"label.tf": "💯 All-time top",
+		"label.ta": "✍️ Top authors",
+		"label.sl": "📬 Subscriptions",
+		"label.dg": "📰 Digest",
+		"label.sg": "⚙️ Settings",
+		"label.im": "👁️ Preview",
+		"label.fd": "💛 Add favorite",
+		"label.fr": "❤️ Remove favorite",
+		"label.mo": "⋯ More",
+		"label.cc": "📁 Move to collection",
+		"label.sp": "📥 Add all to favorites",
+		"label.xd": "🗑 Yes, delete",
+		"label.dd": "⏰ Daily digest",
+		"label.dw": "📆 Weekly digest",
+		"label.dx": "Cancel digest",
+		"label.sm": "📝 Read post",
+		"label.cm": "💬 Comments",
+		"label.sa": "📬 Follow author",
+		"label.au": "📚 Author's posts",
+		"help.nw":  "latest posts",
+		"help.rd":  "10 random posts",
+		"help.fl":  "saved photos",
+		"help.cs":  "organize favorites",
+		"help.hd":  "top today",
+		"help.hm":  "top this week",
+		"help.hy":  "top this year",
+		"help.od":  "this day in past years",
+		"help.os":  "every morning",
+		"help.ou":  "stop daily push",
+		"help.tw":  "most saved this week",
+		"help.tf":  "most saved ever",
+		"help.ta":  "most active authors",
+		"help.sl":  "new post alerts",
+		"help.dg":  "scheduled hot posts",
+		"help.sg":  "preferences",
+
+		"alt.query":        "Here are some photos~",
+		"alt.random":       "Your random picks are here",
+		"alt.newest":       "Fresh photos are here!",
+		"alt.favorites":    "Your favorites are here",
+		"alt.preview":      "Preview images are here",
+		"alt.on_this_day":  "On this day is here",
+		"alt.subscription": "New posts from your subscriptions",
+		"alt.daily_hot":    "Today's hot posts are here",
+		"alt.weekly_hot":   "This week's hot posts are here",
+
+		"error.query":     "Something went wrong, please try again later",
+		"error.setting":   "Unable to save, please try again later",
+		"article.missing": "This article can't be found, it may have been deleted",
+
+		"favorite.added":         "Added to favorites. Type 「%s text」 to add a note",
+		"favorite.removed":       "Removed from favorites",
+		"favorite.empty":         "No favorites yet. Tap 「%s」 on a photo you like",
+		"favorite.sort_added":    "🕒 Recently added",
+		"favorite.sort_push":     "😍 Most pushed",
+		"favorite.sort_date":     "📅 Post date",
+		"group.favorite_added":   "%s added it to group favorites",
+		"group.favorite_removed": "%s removed it from group favorites",
+
+		"on_this_day.empty":        "No photos found on this day in past years QQ",
+		"on_this_day.subscribed":   "You'll get On this day every morning",
+		"on_this_day.unsubscribed": "On this day push is turned off",
+
+		"settings.title":   "⚙️ Your settings",
+		"settings.updated": "✅ Settings updated",
+		"settings.choose":  "Choose %s",
+		"settings.group":   "In groups, type 「%s %s」 to see group settings",
+
+		"share.usage":           "Type 「%s code」",
+		"share.private_only":    "Please message the bot directly to manage shares",
+		"share.all_favorites":   "All favorites",
+		"share.collection_name": "「%s」",
+		"share.not_shared":      "%s hasn't been shared yet",
+		"share.revoked":         "The share code of %s no longer works",
+		"share.created":         "🔗 Share code of %s: %s\nFriends can type 「%s %s」 to the bot to browse your current favorites",
+		"share.link":            "Or just open: %s",
+		"share.revoke_hint":     "Type 「%s」 to revoke the share code",
+		"share.not_found":       "Share code %s doesn't exist or has been revoked",
+		"share.copied":          "Added %d posts to your favorites, skipped %d you already had",
+		"alt.share":             "Shared favorites are here",
+		"alt.share_collection":  "Shared collection 「%s」 is here",
+
+		"collection.tips":            "Type 「%s name」 to create a collection\n「%s old new」 to rename\n「%s name」 to delete, its posts become uncategorized\n「%s name」 to get a share code for friends",
+		"collection.title":           "📁 Your collections",
+		"collection.all":             "All",
+		"collection.none":            "Uncategorized",
+		"collection.private_only":    "Please message me directly to manage collections",
+		"collection.invalid_name":    "Collection names can be up to %d characters and can't be 「%s」 or 「%s」",
+		"collection.too_many":        "You can create up to %d collections",
+		"collection.exists":          "Collection 「%s」 already exists",
+		"collection.created":         "Created 「%s」. You can put favorites into it when adding them",
+		"collection.not_found":       "Collection 「%s」 not found",
+		"collection.renamed":         "Renamed 「%s」 to 「%s」",
+		"collection.deleted":         "Deleted 「%s」, its %d posts are now %s",
+		"collection.create_hint":     "Type 「%s name」 to organize your favorites",
+		"collection.choose":          "Choose a collection",
+		"collection.choose_suffix":   ". Which collection should it go to?",
+		"collection.deleted_already": "This collection has been deleted",
+		"collection.moved":           "Moved to 「%s」",
+		"collection.empty":           "This collection is empty",
+
+		"note.group":       "Notes aren't supported for group favorites",
+		"note.too_long":    "Notes can be up to %d characters",
+		"note.no_favorite": "No favorites to add a note to yet",
+		"note.cleared":     "Cleared the note of your latest favorite",
+		"note.set":         "Added a note to your latest favorite: %s",
+
+		"subscription.tips":         "Type 「%s keyword」, 「%s %s author-id」 or 「%s %s category」 to get new post alerts\nType 「%s 23:00-08:00」 to set quiet hours, 「%s %s」 to turn them off",
+		"subscription.private_only": "Please message me directly to manage subscriptions",
+		"subscription.added":        "Subscribed to 「%s」. You'll be notified of new posts",
+		"subscription.removed":      "Unsubscribed from 「%s」",
+		"subscription.too_long":     "Subscriptions can be up to %d characters",
+		"subscription.too_many":     "You can have up to %d subscriptions, please remove some first",
+		"subscription.quiet_off":    "Quiet hours turned off",
+		"subscription.quiet_set":    "Alerts between %s and %s will be sent afterwards",
+		"subscription.empty":        "You haven't subscribed to anything yet",
+		"subscription.title":        "Your subscriptions:",
+		"subscription.cancel":       "Stop %s",
+		"subscription.quiet_hours":  "Quiet hours: %s-%s",
+
+		"weekday.0":             "Sun",
+		"weekday.1":             "Mon",
+		"weekday.2":             "Tue",
+		"weekday.3":             "Wed",
+		"weekday.4":             "Thu",
+		"weekday.5":             "Fri",
+		"weekday.6":             "Sat",
+		"digest.private_only":   "Please message me directly to set up digests",
+		"digest.description":    "Hot posts pushed at the time you choose (Taiwan time)",
+		"digest.daily_status":   "daily %s",
+		"digest.weekly_status":  "every %s %s",
+		"digest.status":         "Subscribed: %s",
+		"digest.none":           "No digest yet",
+		"digest.paused":         "⏸ Paused in settings",
+		"digest.daily_set":      "Today's hot posts will be pushed every day at %s",
+		"digest.weekly_set":     "This week's hot posts will be pushed every %s at %s",
+		"digest.choose_weekday": "Which day should the weekly digest be pushed?",
+		"digest.cancelled":      "Digest cancelled",
+
+		"export.private_only":   "Please message the bot directly to export or import favorites",
+		"export.usage":          "Type 「%s %s」 or 「%s %s」",
+		"export.unavailable":    "Export is unavailable, please try again later",
+		"export.link":           "📦 Download link for your favorites, valid for %d minutes. Don't share it:\n%s",
+		"import.usage":          "Send the .json or .csv file from 「%s」 here to import it. Posts already in your favorites are skipped",
+		"import.invalid_file":   "Only .json or .csv files from 「%s」 can be imported",
+		"import.too_large":      "The file is too large, the limit is %d KB",
+		"import.failed":         "Import failed, please try again later",
+		"import.invalid_format": "Invalid file format: %v",
+		"import.empty":          "the file is empty",
+		"import.no_article_id":  "the article_id column is missing",
+		"import.too_many":       "Up to %d posts can be imported at once",
+		"import.partial":        "Import stopped halfway after %d posts, please try again later",
+		"import.done":           "Imported %d posts to your favorites, skipped %d you already had",
+		"import.missing":        ", %d posts no longer exist and were not imported",
+
+		"privacy.private_only": "Please message the bot directly to delete your data",
+		"privacy.confirm":      "Delete your favorites, collections and shares, new post alerts, digests and settings? This can't be undone.\n\nJust ignore this message if you want to keep them",
+		"privacy.failed":       "Unable to delete, please try again later",
+		"privacy.deleted":      "All your data has been deleted. Using favorites again will start a new record",
+
+		"comments.empty":             "No comments on this post yet",
+		"comments.remaining":         "%d more comments",
+		"comments.next":              "More comments",
+		"alt.more_comments":          "More comments",
+		"summary.images_only":        "This post only has images",
+		"orphan.title":               "[Deleted] Original post is gone",
+		"orphan.note":                "⚠️ Will be removed from favorites",
+		"leaderboard.pending":        "The leaderboard is still being calculated, please try again later",
+		"leaderboard.favorite_count": "Saved by %d",
+		"leaderboard.author_stats":   "%d 😍\t%d posts",
+		"leaderboard.empty":          "No posts match your settings. Try changing the categories or safe mode in settings",
+		"alt.top_favorite":           "Top favorites are here",
+		"alt.weekly_top_favorite":    "This week's top favorites are here",
+		"alt.top_author":             "Top authors are here",
+		"alt.author":                 "Posts by %s are here",
+
+		"group.someone":             "Someone",
+		"group.welcome":             "Hi everyone, I'm %s!\nStart a message with 「%s」 to call me, e.g. 「%s 新垣結衣」\nType 「%s %s」 to keep me quiet for a while",
+		"group.enabled":             "%s turned PTT Beauty on",
+		"group.disabled":            "%s turned PTT Beauty off. Type 「%s %s」 to turn it back on",
+		"group.categories_changed":  "%s changed the group categories",
+		"group.category_usage":      "Usage: %s %s 正妹 帥哥, or %s %s %s",
+		"group.too_many_categories": "Up to %d categories",
+		"group.category_too_long":   "Category 「%s」 is too long",
+		"group.status":              "Status: %s\nCategories: %s\nGroup favorites: %d",
+		"group.status_enabled":      "On",
+		"group.status_disabled":     "Off",
+		"group.default_categories":  "%s (正妹)",
+
+		"setting.categories":                     "Categories",
+		"setting.categories.default":             "Beauty (default)",
+		"setting.categories.帥哥":                  "Handsome",
+		"setting.categories.正妹,帥哥":               "Beauty+Handsome",
+		"setting.categories.神人":                  "Who's this",
+		"setting.categories.正妹,神人":               "Beauty+Who's this",
+		"setting.page_size":                      "Page size",
+		"setting.page_size.default":              "Default",
+		"setting.page_size.3":                    "3 posts",
+		"setting.page_size.5":                    "5 posts",
+		"setting.page_size.9":                    "9 posts",
+		"setting.order":                          "Sort",
+		"setting.order.default":                  "Default",
+		"setting.order." + controllers.OrderPush: "Most pushed",
+		"setting.order." + controllers.OrderDate: "Post date",
+		"setting.no_digest":                      "Digest",
+		"setting.no_digest.default":              "On",
+		"setting.no_digest.on":                   "Paused",
+		"setting.language":                       "Language",
+		"setting.safe_mode":                      "Safe mode",
+		"setting.safe_mode.default":              "Off",
+		"setting.safe_mode.on":                   "On",
+	},
+	controllers.LanguageJa: {
+		"title":          "💋 PTT美女",
+		"menu.alt":       "何をしましょうか？",
+		"list.separator": "、",
+		"nav.more":       "続きを見る？",
+		"nav.previous":   "前へ %d",
+		"nav.next":       "次へ %d",
+		"nav.next_image": "次へ",
+		"card.click":     "👉 開く",
+		"search_tips":    "キーワードを入力すると記事タイトルを検索します。例：「新垣結衣」\n「%s」と入力するとメニューを開きます",
+		"welcome":        "%sを友だち追加してくれてありがとう！\n%s",
+
+		"label.mn": "📖 メニュー",
+		"label.st": "🔍 検索のヒント",
+		"label.nw": "🎊 最新",
+		"label.rd": "👩 ランダム10連",
+		"label.fl": "❤️ お気に入り",
+		"label.cs": "📁 コレクション",
+		"label.hd": "📈 今日の人気",
+		"label.hm": "🔥 最近の人気",
+		"label.hy": "🏆 年間人気",
+		"label.od": "📅 過去の今日",
+		"label.os": "🔔 毎日配信",
+		"label.ou": "🔕 配信停止",
+		"label.tw": "🏅 今週のお気に入り",
+		"label.tf": "💯 お気に入りランキング",
+		"label.ta": "✍️ 投稿者ランキング",
+		"label.sl": "📬 購読",
+		"label.dg": "📰 人気ダイジェスト",
+		"label.sg": "⚙️ 個人設定",
+		"label.im": "👁️ プレビュー",
+		"label.fd": "💛 お気に入りに追加",
+		"label.fr": "❤️ お気に入りから削除",
+		"label.mo": "⋯ その他",
+		"label.cc": "📁 コレクションへ移動",
+		"label.sp": "📥 すべてお気に入りに追加",
+		"label.xd": "🗑 削除する",
+		"label.dd": "⏰ 毎日のダイジェスト",
+		"label.dw": "📆 毎週のダイジェスト",
+		"label.dx": "ダイジェストを解除",
+		"label.sm": "📝 本文を見る",
+		"label.cm": "💬 コメントを見る",
+		"label.sa": "📬 投稿者を購読",
+		"label.au": "📚 投稿者の記事",
+		"help.nw":  "最新の投稿",
+		"help.rd":  "ランダムに10件",
+		"help.fl":  "保存した写真",
+		"help.cs":  "お気に入りを整理",
+		"help.hd":  "今日の最多推し",
+		"help.hm":  "今週の最多推し",
+		"help.hy":  "今年の最多推し",
+		"help.od":  "過去の同じ日",
+		"help.os":  "毎朝お届け",
+		"help.ou":  "配信を停止",
+		"help.tw":  "今週最も保存",
+		"help.tf":  "歴代最も保存",
+		"help.ta":  "よく投稿する人",
+		"help.sl":  "新着通知",
+		"help.dg":  "定時の人気投稿",
+		"help.sg":  "個人設定",
+
+		"alt.query":        "写真を見つけました~",
+		"alt.random":       "ランダムにお届けします",
+		"alt.newest":       "最新の写真が届きました！",
+		"alt.favorites":    "お気に入りをお届けします",
+		"alt.preview":      "プレビュー画像をお届けします",
+		"alt.on_this_day":  "過去の今日をお届けします",
+		"alt.subscription": "購読中の新しい投稿があります",
+		"alt.daily_hot":    "今日の人気をお届けします",
+		"alt.weekly_hot":   "今週の人気をお届けします",
+
+		"error.query":     "取得に失敗しました。しばらくしてからお試しください",
+		"error.setting":   "設定に失敗しました。しばらくしてからお試しください",
+		"article.missing": "記事が見つかりません。削除された可能性があります",
+
+		"favorite.added":         "お気に入りに追加しました。「%s テキスト」でメモを付けられます",
+		"favorite.removed":       "お気に入りから削除しました",
+		"favorite.empty":         "お気に入りはまだありません。気に入った写真で「%s」を押してください",
+		"favorite.sort_added":    "🕒 追加順",
+		"favorite.sort_push":     "😍 推し数順",
+		"favorite.sort_date":     "📅 投稿日順",
+		"group.favorite_added":   "%s がグループのお気に入りに追加しました",
+		"group.favorite_removed": "%s がグループのお気に入りから削除しました",
+
+		"on_this_day.empty":        "過去の今日の写真は見つかりませんでした QQ",
+		"on_this_day.subscribed":   "毎朝、過去の今日をお届けします",
+		"on_this_day.unsubscribed": "過去の今日の配信を停止しました",
+
+		"settings.title":   "⚙️ あなたの設定",
+		"settings.updated": "✅ 設定を更新しました",
+		"settings.choose":  "%sを選んでください",
+		"settings.group":   "グループでは「%s %s」でグループ設定を確認できます",
+
+		"share.usage":           "「%s 共有コード」と入力してください",
+		"share.private_only":    "共有の管理はボットに個別メッセージで行ってください",
+		"share.all_favorites":   "すべてのお気に入り",
+		"share.collection_name": "「%s」",
+		"share.not_shared":      "%sはまだ共有されていません",
+		"share.revoked":         "%sの共有コードを無効にしました",
+		"share.created":         "🔗 %sの共有コード：%s\n友だちがボットに「%s %s」と送ると、今のお気に入りを閲覧できます",
+		"share.link":            "直接開く：%s",
+		"share.revoke_hint":     "「%s」と入力すると共有コードを無効にできます",
+		"share.not_found":       "共有コード %s は存在しないか無効になっています",
+		"share.copied":          "%d 件をお気に入りに追加しました。登録済みの %d 件はスキップしました",
+		"alt.share":             "共有されたお気に入りをお届けします",
+		"alt.share_collection":  "共有されたコレクション「%s」をお届けします",
+
+		"collection.tips":            "「%s 名前」でコレクションを作成\n「%s 旧名 新名」で名前を変更\n「%s 名前」で削除、中の記事は未分類になります\n「%s 名前」で友だち用の共有コードを作成",
+		"collection.title":           "📁 あなたのコレクション",
+		"collection.all":             "すべて",
+		"collection.none":            "未分類",
+		"collection.private_only":    "コレクションは個別メッセージで設定してください",
+		"collection.invalid_name":    "コレクション名は %d 文字までで、「%s」や「%s」は使えません",
+		"collection.too_many":        "コレクションは %d 個まで作成できます",
+		"collection.exists":          "「%s」はすでにあります",
+		"collection.created":         "「%s」を作成しました。お気に入りに追加するときに選べます",
+		"collection.not_found":       "「%s」が見つかりません",
+		"collection.renamed":         "「%s」を「%s」に変更しました",
+		"collection.deleted":         "「%s」を削除しました。中の %d 件は%sになりました",
+		"collection.create_hint":     "「%s 名前」でお気に入りを分類できます",
+		"collection.choose":          "コレクションを選んでください",
+		"collection.choose_suffix":   "。どのコレクションに入れますか？",
+		"collection.deleted_already": "このコレクションは削除されています",
+		"collection.moved":           "「%s」に移動しました",
+		"collection.empty":           "このコレクションは空です",
+
+		"note.group":       "グループのお気に入りにはメモを付けられません",
+		"note.too_long":    "メモは %d 文字までです",
+		"note.no_favorite": "メモを付けるお気に入りがまだありません",
+		"note.cleared":     "最新のお気に入りのメモを消しました",
+		"note.set":         "最新のお気に入りにメモを付けました：%s",
+
+		"subscription.tips":         "「%s キーワード」、「%s %s 投稿者id」または「%s %s カテゴリ」で新着通知を購読\n「%s 23:00-08:00」でおやすみ時間を設定、「%s %s」で解除",
+		"subscription.private_only": "購読は個別メッセージで設定してください",
+		"subscription.added":        "「%s」を購読しました。新しい投稿があればお知らせします",
+		"subscription.removed":      "「%s」の購読を解除しました",
+		"subscription.too_long":     "購読する文字は %d 文字までです",
+		"subscription.too_many":     "購読は %d 件までです。いくつか解除してください",
+		"subscription.quiet_off":    "おやすみ時間を解除しました",
+		"subscription.quiet_set":    "%s から %s までの通知は後でお届けします",
+		"subscription.empty":        "まだ何も購読していません",
+		"subscription.title":        "購読中：",
+		"subscription.cancel":       "解除 %s",
+		"subscription.quiet_hours":  "おやすみ時間：%s-%s",
+
+		"weekday.0":             "日曜",
+		"weekday.1":             "月曜",
+		"weekday.2":             "火曜",
+		"weekday.3":             "水曜",
+		"weekday.4":             "木曜",
+		"weekday.5":             "金曜",
+		"weekday.6":             "土曜",
+		"digest.private_only":   "ダイジェストは個別メッセージで設定してください",
+		"digest.description":    "選んだ時間 (台湾時間) に人気の投稿をお届けします",
+		"digest.daily_status":   "毎日 %s",
+		"digest.weekly_status":  "毎週%s %s",
+		"digest.status":         "購読中：%s",
+		"digest.none":           "ダイジェストはまだ購読していません",
+		"digest.paused":         "⏸ 個人設定で一時停止中",
+		"digest.daily_set":      "毎日 %s に今日の人気をお届けします",
+		"digest.weekly_set":     "毎週%s %s に今週の人気をお届けします",
+		"digest.choose_weekday": "毎週何曜日にお届けしますか？",
+		"digest.cancelled":      "ダイジェストを解除しました",
+
+		"export.private_only":   "お気に入りのエクスポートとインポートは個別メッセージで行ってください",
+		"export.usage":          "「%s %s」または「%s %s」と入力してください",
+		"export.unavailable":    "現在エクスポートできません。しばらくしてからお試しください",
+		"export.link":           "📦 お気に入りのダウンロードリンク、%d 分間有効です。他の人と共有しないでください：\n%s",
+		"import.usage":          "「%s」でダウンロードした .json または .csv ファイルをここに送るとインポートします。登録済みの記事はスキップします",
+		"import.invalid_file":   "インポートできるのは「%s」でダウンロードした .json または .csv ファイルだけです",
+		"import.too_large":      "ファイルが大きすぎます。%d KB までです",
+		"import.failed":         "インポートに失敗しました。しばらくしてからお試しください",
+		"import.invalid_format": "ファイル形式が正しくありません：%v",
+		"import.empty":          "内容がありません",
+		"import.no_article_id":  "article_id 列がありません",
+		"import.too_many":       "一度にインポートできるのは %d 件までです",
+		"import.partial":        "%d 件をインポートしたところで失敗しました。しばらくしてからもう一度お試しください",
+		"import.done":           "%d 件をお気に入りにインポートしました。登録済みの %d 件はスキップしました",
+		"import.missing":        "。%d 件は元の記事がなくなっていたためインポートしませんでした",
+
+		"privacy.private_only": "データの削除は個別メッセージで行ってください",
+		"privacy.confirm":      "お気に入り、コレクションと共有、新着通知、ダイジェスト、各種設定を削除しますか？削除すると元に戻せません。\n\n削除しない場合はこのメッセージを無視してください",
+		"privacy.failed":       "削除に失敗しました。しばらくしてからお試しください",
+		"privacy.deleted":      "データをすべて削除しました。お気に入りなどを使うと新しく記録されます",
+
+		"comments.empty":             "この記事にはまだコメントがありません",
+		"comments.remaining":         "あと %d 件のコメント",
+		"comments.next":              "次のコメント",
+		"alt.more_comments":          "コメントの続き",
+		"summary.images_only":        "この記事は画像だけです",
+		"orphan.title":               "[削除済み] 元の記事はありません",
+		"orphan.note":                "⚠️ お気に入りから自動で削除されます",
+		"leaderboard.pending":        "ランキングを計算中です。しばらくしてからお試しください",
+		"leaderboard.favorite_count": "%d 人が保存",
+		"leaderboard.author_stats":   "%d 😍\t%d 件の記事",
+		"leaderboard.empty":          "設定に合う記事がありません。設定でカテゴリやセーフモードを変更してみてください",
+		"alt.top_favorite":           "お気に入りランキングをお届けします",
+		"alt.weekly_top_favorite":    "今週のお気に入りをお届けします",
+		"alt.top_author":             "投稿者ランキングをお届けします",
+		"alt.author":                 "%s の記事をお届けします",
+
+		"group.someone":             "誰か",
+		"group.welcome":             "みなさん、%sです！\nメッセージの先頭に「%s」を付けると呼び出せます。例：「%s 新垣結衣」\n「%s %s」と入力するとしばらく静かにします",
+		"group.enabled":             "%s がPTT美女をオンにしました",
+		"group.disabled":            "%s がPTT美女をオフにしました。「%s %s」でオンに戻せます",
+		"group.categories_changed":  "%s がグループのカテゴリを変更しました",
+		"group.category_usage":      "使い方：%s %s 正妹 帥哥、または %s %s %s",
+		"group.too_many_categories": "カテゴリは %d 個までです",
+		"group.category_too_long":   "カテゴリ「%s」が長すぎます",
+		"group.status":              "状態：%s\nカテゴリ：%s\nグループのお気に入り：%d 件",
+		"group.status_enabled":      "オン",
+		"group.status_disabled":     "オフ",
+		"group.default_categories":  "%s (正妹)",
+
+		"setting.categories":                     "カテゴリ",
+		"setting.categories.default":             "正妹 (デフォルト)",
+		"setting.categories.帥哥":                  "イケメン",
+		"setting.categories.正妹,帥哥":               "正妹+イケメン",
+		"setting.categories.神人":                  "人探し",
+		"setting.categories.正妹,神人":               "正妹+人探し",
+		"setting.page_size":                      "表示件数",
+		"setting.page_size.default":              "デフォルト",
+		"setting.page_size.3":                    "3 件",
+		"setting.page_size.5":                    "5 件",
+		"setting.page_size.9":                    "9 件",
+		"setting.order":                          "並び順",
+		"setting.order.default":                  "デフォルト",
+		"setting.order." + controllers.OrderPush: "推し数順",
+		"setting.order." + controllers.OrderDate: "投稿日順",
+		"setting.no_digest":                      "ダイジェスト",
+		"setting.no_digest.default":              "オン",
+		"setting.no_digest.on":                   "一時停止",
+		"setting.language":                       "言語",
+		"setting.safe_mode":                      "セーフモード",
+		"setting.safe_mode.default":              "オフ",
+		"setting.safe_mode.on":                   "オン",
+	},
+}
+
+// getLocale 取出事件來源的語言，群組一律使用預設語言
+func getLocale(event *linebot.Event) string {
+	if getGroupId(event.Source) != "" {
+		return defaultLocale
+	}
+	return getSettingsLocale(getSettings(event))
+}
+
+// getSettingsLocale 回傳設定裡的語言，不支援時使用預設語言
+func getSettingsLocale(settings *controllers.Settings) string {
+	if _, ok := catalog[settings.Language]; ok {
+		return settings.Language
+	}
+	return defaultLocale
+}
+
+// tr 取出語言的訊息並代入參數，缺少翻譯時退回預設語言，都沒有時回傳 key
+func tr(locale string, key string, args ...interface{}) string {
+	message, ok := catalog[locale][key]
+	if !ok {
+		if message, ok = catalog[defaultLocale][key]; !ok {
+			message = key
+		}
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(message, args...)
+	}
+	return message
+}
+
+// localize 取出語言的訊息，缺少翻譯時使用 fallback，給本身就帶著繁體中文的 Route 與設定選項使用
+func localize(locale string, key string, fallback string) string {
+	if message, ok := catalog[locale][key]; ok {
+		return message
+	}
+	return fallback
+}
+
+func routeLabel(r *Route, locale string) string {
+	return localize(locale, "label."+string(r.Code), r.Label)
+}
+
+func routeHelp(r *Route, locale string) string {
+	return localize(locale, "help."+string(r.Code), r.Help)
+}
+
+// actionLabel 回傳動作代碼在該語言的按鈕名稱
+func actionLabel(code ActionCode, locale string) string {
+	return routeLabel(routesByCode[code], locale)
+}
+
+// localizedTriggers 回傳動作在其他語言的按鈕名稱，訊息動作送出的文字也要能觸發動作
+func localizedTriggers(r *Route) []string {
+	triggers := []string{}
+	for locale := range catalog {
+		if label := routeLabel(r, locale); label != r.Label {
+			triggers = append(triggers, label)
+		}
+	}
+	return triggers
+}
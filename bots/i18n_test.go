@@ -0,0 +1,60 @@
+package bots
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mong0520/linebot-ptt-beauty/controllers"
+)
+
+func TestTr(t *testing.T) {
+	catalog["test"] = map[string]string{"test.only_en": "only %s"}
+	defer delete(catalog, "test")
+	tests := []struct {
+		name   string
+		locale string
+		key    string
+		args   []interface{}
+		want   string
+	}{
+		{"translated", controllers.LanguageEn, "favorite.removed", nil, "Removed from favorites"},
+		{"format args", controllers.LanguageEn, "collection.moved", []interface{}{"長髮"}, "Moved to 「長髮」"},
+		{"missing in locale falls back to zh-TW", "test", "favorite.removed", nil, "已從最愛中移除"},
+		{"unknown locale falls back to zh-TW", "fr", "collection.moved", []interface{}{"長髮"}, "已移到「長髮」"},
+		{"missing key returns key", controllers.LanguageJa, "no.such_key", nil, "no.such_key"},
+		{"key only in locale", "test", "test.only_en", []interface{}{"this"}, "only this"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tr(tt.locale, tt.key, tt.args...); got != tt.want {
+				t.Errorf("tr(%q, %q) = %q, want %q", tt.locale, tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+// 其他語言的 key 都要在繁體中文找得到，參數個數也要一樣；按鈕名稱要對得到動作代碼，
+// 它和設定選項的繁體中文分別取自 Route 與 settingDefinitions
+func TestCatalogKeys(t *testing.T) {
+	for _, locale := range []string{controllers.LanguageEn, controllers.LanguageJa} {
+		for key, message := range catalog[locale] {
+			if code := strings.TrimPrefix(strings.TrimPrefix(key, "label."), "help."); code != key {
+				if routesByCode[ActionCode(code)] == nil {
+					t.Errorf("%s: %q is not a registered action", locale, key)
+				}
+				continue
+			}
+			if strings.HasPrefix(key, "setting.") {
+				continue
+			}
+			zh, ok := catalog[defaultLocale][key]
+			if !ok {
+				t.Errorf("%s: %q is missing in %s", locale, key, defaultLocale)
+				continue
+			}
+			if strings.Count(message, "%") != strings.Count(zh, "%") {
+				t.Errorf("%s: %q has different arguments from %s", locale, key, defaultLocale)
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package bots
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/mong0520/linebot-ptt-beauty/controllers"
+	"github.com/mong0520/linebot-ptt-beauty/models"
+)
+
+const (
+	CodeWeeklyTopFavorite ActionCode = "tw"
+	CodeTopFavorite       ActionCode = "tf"
+	CodeTopAuthor         ActionCode = "ta"
+	CodeAuthor            ActionCode = "au"
+)
+
+func init() {
+	registerRoute(&Route{Code: CodeWeeklyTopFavorite, Label: ActionWeeklyTopFavorite, Triggers: []string{ActionWeeklyTopFavorite},
+		Help: "本週最多人收藏", MenuOrder: 100, Handler: actionTopFavorite})
+	registerRoute(&Route{Code: CodeTopFavorite, Label: ActionTopFavorite, Triggers: []string{ActionTopFavorite},
+		Help: "史上最多人收藏", MenuOrder: 110, Handler: actionTopFavorite})
+	registerRoute(&Route{Code: CodeTopAuthor, Label: ActionTopAuthor, Triggers: []string{ActionTopAuthor},
+		Help: "最會發文的作者", MenuOrder: 120, Handler: actionTopAuthor})
+	registerRoute(&Route{Code: CodeAuthor, Label: ActionAuthor, Help: "作者的文章", Handler: actionAuthor})
+}
+
+// 排行榜重新計算的間隔
+var leaderboardInterval = time.Hour
+
+func startLeaderboardJob() {
+	runEvery("leaderboard", leaderboardInterval, func() {
+		if err := controllers.RefreshLeaderboard(meta, maxCountOfCarousel); err != nil {
+			meta.Log.Println("Refresh leaderboard fail", err)
+		}
+	})
+}
+
+func actionTopFavorite(event *linebot.Event, pb *Postback) {
+	locale := getLocale(event)
+	board := controllers.GetLeaderboard()
+	records := board.AllFavorites
+	counts := board.FavoriteCounts
+	label := tr(locale, "alt.top_favorite")
+	if pb.Action == CodeWeeklyTopFavorite {
+		records = board.WeeklyFavorites
+		counts = board.WeeklyFavoriteCounts
+		label = tr(locale, "alt.weekly_top_favorite")
+	}
+	if len(records) == 0 {
+		sendTextMessage(event, tr(locale, "leaderboard.pending"))
+		return
+	}
+	// 排行榜維持原本的名次，只套用安全模式
+	settings := getSettings(event)
+	records = filterArticles(records, settings.Filter(), len(records))
+	notes := map[string]string{}
+	for _, record := range records {
+		notes[record.ArticleID] = tr(locale, "leaderboard.favorite_count", counts[record.ArticleID])
+	}
+	carousel := newArticleCarousel(event, records)
+	carousel.notes = notes
+	sendArticles(event, carousel, label)
+}
+
+func actionTopAuthor(event *linebot.Event, pb *Postback) {
+	locale := getLocale(event)
+	authors := controllers.GetLeaderboard().TopAuthors
+	// 快取只有預設分類的排行，改過分類或開啟安全模式時依設定重新查詢
+	if filter := getSettings(event).Filter(); !filter.IsDefault() {
+		var err error
+		if authors, err = controllers.GetTopAuthors(meta.Collection, maxCountOfCarousel, filter); err != nil {
+			meta.Log.Println("Unable to get top authors", err)
+			sendTextMessage(event, tr(locale, "error.query"))
+			return
+		} else if len(authors) == 0 {
+			sendTextMessage(event, tr(locale, "leaderboard.empty"))
+			return
+		}
+	}
+	template := getAuthorCarouseTemplate(authors, locale)
+	if template == nil {
+		sendTextMessage(event, tr(locale, "leaderboard.pending"))
+		return
+	}
+	sendCarouselMessage(event, template, tr(locale, "alt.top_author"))
+}
+
+func actionAuthor(event *linebot.Event, pb *Postback) {
+	author := pb.Author
+	locale := getLocale(event)
+	settings := getSettings(event)
+	records, err := controllers.GetByAuthor(meta.Collection, author, getPageSize(settings, maxCountOfCarousel), settings.Filter())
+	if err != nil {
+		meta.Log.Println("Unable to get articles of author", author, err)
+		sendTextMessage(event, tr(locale, "error.query"))
+		return
+	}
+	if len(records) == 0 {
+		sendTextMessage(event, tr(locale, "leaderboard.empty"))
+		return
+	}
+	sortArticles(records, settings.Order)
+	carousel := newArticleCarousel(event, records)
+	sendArticles(event, carousel, tr(locale, "alt.author", author))
+}
+
+func getAuthorCarouseTemplate(authors []controllers.AuthorRank, locale string) (template *linebot.CarouselTemplate) {
+	if len(authors) == 0 {
+		return nil
+	}
+
+	columnList := []*linebot.CarouselColumn{}
+	for idx, author := range authors {
+		top := author.TopArticle
+		thumnailUrl := defaultImage
+		if len(top.ImageLinks) > 0 {
+			thumnailUrl = top.ImageLinks[0]
+		}
+		title := fmt.Sprintf("No.%d %s", idx+1, author.Author)
+		text := tr(locale, "leaderboard.author_stats", author.Push, author.Articles)
+		lable := fmt.Sprintf("%s (%d)", actionLabel(CodeAllImage, locale), len(top.ImageLinks))
+		postBackData := postbackData(&Postback{Action: CodeAllImage, ArticleID: top.ArticleID})
+		dataAuthor := postbackData(&Postback{Action: CodeAuthor, Author: author.Author})
+		tmpColumn := linebot.NewCarouselColumn(
+			thumnailUrl,
+			title,
+			text,
+			linebot.NewURIAction(tr(locale, "card.click"), getArticleURL(top)),
+			linebot.NewPostbackAction(lable, postBackData, "", ""),
+			linebot.NewPostbackAction(actionLabel(CodeAuthor, locale), dataAuthor, "", ""),
+		)
+		columnList = append(columnList, tmpColumn)
+	}
+	template = linebot.NewCarouselTemplate(columnList...)
+	return template
+}
+
+// getArticleURL 沒有代表文章時連到表特版首頁
+func getArticleURL(record models.ArticleDocument) string {
+	if record.URL == "" {
+		return "https://www.ptt.cc/bbs/Beauty/index.html"
+	}
+	return record.URL
+}
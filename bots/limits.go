@@ -0,0 +1,257 @@
+package bots
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/mong0520/linebot-ptt-beauty/utils"
+)
+
+// Line Messaging API 各欄位的上限，長度皆以字元計算
+// https://developers.line.biz/en/reference/messaging-api/#template-messages
+const (
+	maxMessagesPerReply      = 5
+	maxAltTextLength         = 400
+	maxTextMessageLength     = 5000
+	maxColumnsPerCarousel    = 10
+	maxColumnTitleLength     = 40
+	maxColumnTextLength      = 120
+	maxColumnTextWithImage   = 60
+	maxButtonsTextLength     = 160
+	maxButtonsActions        = 4
+	maxConfirmTextLength     = 240
+	maxActionLabelLength     = 20
+	maxPostbackDataLength    = 300
+	maxFlexBubblesInCarousel = 10
+	maxMulticastRecipients   = 500
+	maxQuickReplyItems       = 13
+	// Flex 的文字沒有單獨的上限，但一個 bubble 最大 30KB，文字截到 1000 字避免整個 bubble 超過
+	maxFlexTextLength = 1000
+)
+
+var errNoMessageToSend = errors.New("no message left to send after applying limits")
+
+// limitMessage 把即將送出的訊息截成 Line 接受的長度，避免整則訊息被拒絕。
+// postback data 截斷後就無法解析，超過上限時回傳錯誤，由呼叫的地方丟掉這則訊息
+func limitMessage(message linebot.SendingMessage) error {
+	switch m := message.(type) {
+	case *linebot.TextMessage:
+		m.Text = utils.TruncateRunes(m.Text, maxTextMessageLength)
+	case *linebot.TemplateMessage:
+		m.AltText = utils.TruncateRunes(m.AltText, maxAltTextLength)
+		return limitTemplate(m.Template)
+	case *linebot.FlexMessage:
+		m.AltText = utils.TruncateRunes(m.AltText, maxAltTextLength)
+		return limitFlexContainer(m.Contents)
+	}
+	return nil
+}
+
+// limitMessages 套用 limitMessage，丟掉超過則數上限或無法修正的訊息
+func limitMessages(messages []linebot.SendingMessage) []linebot.SendingMessage {
+	if len(messages) > maxMessagesPerReply {
+		meta.Log.Printf("Drop %d messages over limit\n", len(messages)-maxMessagesPerReply)
+		messages = messages[:maxMessagesPerReply]
+	}
+	limited := []linebot.SendingMessage{}
+	for _, message := range messages {
+		if err := limitMessage(message); err != nil {
+			meta.Log.Println("Drop message:", err)
+			continue
+		}
+		limited = append(limited, message)
+	}
+	return limited
+}
+
+func limitTemplate(template linebot.Template) error {
+	switch t := template.(type) {
+	case *linebot.CarouselTemplate:
+		if len(t.Columns) > maxColumnsPerCarousel {
+			meta.Log.Printf("Drop %d carousel columns over limit\n", len(t.Columns)-maxColumnsPerCarousel)
+			t.Columns = t.Columns[:maxColumnsPerCarousel]
+		}
+		for _, column := range t.Columns {
+			column.Title = utils.TruncateRunes(column.Title, maxColumnTitleLength)
+			column.Text = utils.TruncateRunes(column.Text, getTextLimit(column.ThumbnailImageURL, column.Title, maxColumnTextLength))
+			if err := limitActions(column.Actions); err != nil {
+				return err
+			}
+		}
+	case *linebot.ImageCarouselTemplate:
+		if len(t.Columns) > maxColumnsPerCarousel {
+			meta.Log.Printf("Drop %d image carousel columns over limit\n", len(t.Columns)-maxColumnsPerCarousel)
+			t.Columns = t.Columns[:maxColumnsPerCarousel]
+		}
+		for _, column := range t.Columns {
+			if err := limitAction(column.Action); err != nil {
+				return err
+			}
+		}
+	case *linebot.ButtonsTemplate:
+		t.Title = utils.TruncateRunes(t.Title, maxColumnTitleLength)
+		t.Text = utils.TruncateRunes(t.Text, getTextLimit(t.ThumbnailImageURL, t.Title, maxButtonsTextLength))
+		if len(t.Actions) > maxButtonsActions {
+			t.Actions = t.Actions[:maxButtonsActions]
+		}
+		return limitActions(t.Actions)
+	case *linebot.ConfirmTemplate:
+		t.Text = utils.TruncateRunes(t.Text, maxConfirmTextLength)
+		return limitActions(t.Actions)
+	}
+	return nil
+}
+
+func limitFlexContainer(container linebot.FlexContainer) error {
+	switch c := container.(type) {
+	case *linebot.CarouselContainer:
+		if len(c.Contents) > maxFlexBubblesInCarousel {
+			meta.Log.Printf("Drop %d flex bubbles over limit\n", len(c.Contents)-maxFlexBubblesInCarousel)
+			c.Contents = c.Contents[:maxFlexBubblesInCarousel]
+		}
+		for _, bubble := range c.Contents {
+			if err := limitFlexContainer(bubble); err != nil {
+				return err
+			}
+		}
+	case *linebot.BubbleContainer:
+		if c.Hero != nil {
+			if err := limitFlexComponent(c.Hero); err != nil {
+				return err
+			}
+		}
+		for _, box := range []*linebot.BoxComponent{c.Header, c.Body, c.Footer} {
+			if box == nil {
+				continue
+			}
+			if err := limitFlexComponent(box); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func limitFlexComponent(component linebot.FlexComponent) error {
+	switch c := component.(type) {
+	case *linebot.BoxComponent:
+		for _, child := range c.Contents {
+			if err := limitFlexComponent(child); err != nil {
+				return err
+			}
+		}
+	case *linebot.TextComponent:
+		c.Text = utils.TruncateRunes(c.Text, maxFlexTextLength)
+		return limitAction(c.Action)
+	case *linebot.ButtonComponent:
+		return limitAction(c.Action)
+	case *linebot.ImageComponent:
+		return limitAction(c.Action)
+	}
+	return nil
+}
+
+// getTextLimit 有圖片或標題時，template 內文的上限會降到 60 字
+func getTextLimit(thumbnail string, title string, limit int) int {
+	if thumbnail != "" || title != "" {
+		return maxColumnTextWithImage
+	}
+	return limit
+}
+
+func limitActions(actions []linebot.TemplateAction) error {
+	for _, action := range actions {
+		if err := limitAction(action); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func limitAction(action linebot.TemplateAction) error {
+	switch a := action.(type) {
+	case *linebot.PostbackAction:
+		a.Label = utils.TruncateRunes(a.Label, maxActionLabelLength)
+		if length := utf8.RuneCountInString(a.Data); length > maxPostbackDataLength {
+			return fmt.Errorf("postback data of %q is %d characters, over limit %d", a.Label, length, maxPostbackDataLength)
+		}
+	case *linebot.URIAction:
+		a.Label = utils.TruncateRunes(a.Label, maxActionLabelLength)
+	case *linebot.DatetimePickerAction:
+		a.Label = utils.TruncateRunes(a.Label, maxActionLabelLength)
+	case *linebot.MessageAction:
+		a.Label = utils.TruncateRunes(a.Label, maxActionLabelLength)
+		a.Text = utils.TruncateRunes(a.Text, maxTextMessageLength)
+	}
+	return nil
+}
+
+// newQuickReplyItems 取代 linebot.NewQuickReplyItems。訊息裡的快速回覆在 SDK 是不公開的欄位，
+// 送出前檢查不到，所以在這裡就截掉超過 13 個的按鈕、截短 label，postback data 太長的按鈕直接丟掉
+func newQuickReplyItems(buttons ...*linebot.QuickReplyButton) *linebot.QuickReplyItems {
+	if len(buttons) > maxQuickReplyItems {
+		meta.Log.Printf("Drop %d quick reply buttons over limit\n", len(buttons)-maxQuickReplyItems)
+		buttons = buttons[:maxQuickReplyItems]
+	}
+	limited := []*linebot.QuickReplyButton{}
+	for _, button := range buttons {
+		if action, ok := button.Action.(linebot.TemplateAction); ok {
+			if err := limitAction(action); err != nil {
+				meta.Log.Println("Drop quick reply button:", err)
+				continue
+			}
+		}
+		limited = append(limited, button)
+	}
+	return linebot.NewQuickReplyItems(limited...)
+}
+
+// replyMessage 所有回覆都經過這裡，套用長度限制後再送出
+func replyMessage(event *linebot.Event, messages ...linebot.SendingMessage) (err error) {
+	if messages = limitMessages(messages); len(messages) == 0 {
+		meta.Log.Println(errNoMessageToSend)
+		return errNoMessageToSend
+	}
+	if _, err = bot.ReplyMessage(event.ReplyToken, messages...).Do(); err != nil {
+		meta.Log.Println(err)
+	}
+	return err
+}
+
+// pushMessage 主動推播時使用，同樣套用長度限制
+func pushMessage(to string, messages ...linebot.SendingMessage) (err error) {
+	if messages = limitMessages(messages); len(messages) == 0 {
+		meta.Log.Println(errNoMessageToSend)
+		return errNoMessageToSend
+	}
+	if _, err = bot.PushMessage(to, messages...).Do(); err != nil {
+		meta.Log.Println(err)
+	}
+	return err
+}
+
+// multicastMessage 一次推播給多個使用者，超過人數上限時分批送出
+func multicastMessage(ctx context.Context, to []string, messages ...linebot.SendingMessage) (sent int, err error) {
+	if messages = limitMessages(messages); len(messages) == 0 {
+		meta.Log.Println(errNoMessageToSend)
+		return 0, errNoMessageToSend
+	}
+	for start := 0; start < len(to); start += maxMulticastRecipients {
+		end := start + maxMulticastRecipients
+		if end > len(to) {
+			end = len(to)
+		}
+		if err = ctx.Err(); err != nil {
+			return sent, err
+		}
+		if _, err = bot.Multicast(to[start:end], messages...).WithContext(ctx).Do(); err != nil {
+			meta.Log.Println(err)
+			return sent, err
+		}
+		sent = end
+	}
+	return sent, nil
+}
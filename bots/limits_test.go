@@ -0,0 +1,227 @@
+package bots
+
+import (
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/mong0520/linebot-ptt-beauty/models"
+)
+
+func setupLimitTest() {
+	meta = &models.Model{Log: log.New(ioutil.Discard, "", 0)}
+	postbackSecret = []byte("test-secret")
+}
+
+func TestLimitAction(t *testing.T) {
+	setupLimitTest()
+	longLabel := strings.Repeat("表", 30)
+	tests := []struct {
+		name      string
+		action    linebot.TemplateAction
+		wantLabel string
+		wantErr   bool
+	}{
+		{"postback label", linebot.NewPostbackAction(longLabel, "a=1", "", ""), strings.Repeat("表", 19) + "…", false},
+		{"postback data over limit", linebot.NewPostbackAction("ok", strings.Repeat("x", maxPostbackDataLength+1), "", ""), "ok", true},
+		{"postback data at limit", linebot.NewPostbackAction("ok", strings.Repeat("x", maxPostbackDataLength), "", ""), "ok", false},
+		{"uri label", linebot.NewURIAction(longLabel, "https://www.ptt.cc"), strings.Repeat("表", 19) + "…", false},
+		{"message label", linebot.NewMessageAction(longLabel, "text"), strings.Repeat("表", 19) + "…", false},
+		{"datetime picker label", linebot.NewDatetimePickerAction(longLabel, "a=1", datetimePickerModeTime, "", "", ""), strings.Repeat("表", 19) + "…", false},
+		{"nil action", nil, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := limitAction(tt.action)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			var label string
+			switch a := tt.action.(type) {
+			case *linebot.PostbackAction:
+				label = a.Label
+			case *linebot.URIAction:
+				label = a.Label
+			case *linebot.MessageAction:
+				label = a.Label
+			case *linebot.DatetimePickerAction:
+				label = a.Label
+			}
+			if label != tt.wantLabel {
+				t.Errorf("label = %q, want %q", label, tt.wantLabel)
+			}
+		})
+	}
+}
+
+func TestLimitMessages(t *testing.T) {
+	setupLimitTest()
+	tooLongData := strings.Repeat("x", maxPostbackDataLength+1)
+	tests := []struct {
+		name     string
+		messages []linebot.SendingMessage
+		wantLen  int
+	}{
+		{"keep valid messages", []linebot.SendingMessage{
+			linebot.NewTextMessage("hi"),
+			linebot.NewTemplateMessage("alt", linebot.NewButtonsTemplate("", "", "text", linebot.NewPostbackAction("ok", "a=1", "", ""))),
+		}, 2},
+		{"drop messages over count limit", []linebot.SendingMessage{
+			linebot.NewTextMessage("1"), linebot.NewTextMessage("2"), linebot.NewTextMessage("3"),
+			linebot.NewTextMessage("4"), linebot.NewTextMessage("5"), linebot.NewTextMessage("6"),
+		}, maxMessagesPerReply},
+		{"reject template with long postback data", []linebot.SendingMessage{
+			linebot.NewTextMessage("hi"),
+			linebot.NewTemplateMessage("alt", linebot.NewConfirmTemplate("text",
+				linebot.NewPostbackAction("yes", tooLongData, "", ""), linebot.NewMessageAction("no", "no"))),
+		}, 1},
+		{"reject flex with long postback data", []linebot.SendingMessage{
+			linebot.NewFlexMessage("alt", &linebot.BubbleContainer{
+				Type: linebot.FlexContainerTypeBubble,
+				Footer: &linebot.BoxComponent{
+					Type:     linebot.FlexComponentTypeBox,
+					Layout:   linebot.FlexBoxLayoutTypeVertical,
+					Contents: []linebot.FlexComponent{getFlexButton(linebot.NewPostbackAction("ok", tooLongData, "", ""))},
+				},
+			}),
+		}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := limitMessages(tt.messages); len(got) != tt.wantLen {
+				t.Errorf("len(limitMessages) = %d, want %d", len(got), tt.wantLen)
+			}
+		})
+	}
+}
+
+func TestLimitMessageTruncates(t *testing.T) {
+	setupLimitTest()
+	text := linebot.NewTextMessage(strings.Repeat("a", maxTextMessageLength+10))
+	bubble := &linebot.BubbleContainer{
+		Type: linebot.FlexContainerTypeBubble,
+		Hero: &linebot.ImageComponent{
+			Type:   linebot.FlexComponentTypeImage,
+			URL:    defaultImage,
+			Action: linebot.NewURIAction(strings.Repeat("b", 30), "https://www.ptt.cc"),
+		},
+		Body: &linebot.BoxComponent{
+			Type:   linebot.FlexComponentTypeBox,
+			Layout: linebot.FlexBoxLayoutTypeVertical,
+			Contents: []linebot.FlexComponent{
+				&linebot.TextComponent{Type: linebot.FlexComponentTypeText, Text: strings.Repeat("c", maxFlexTextLength+10)},
+				getFlexButton(linebot.NewMessageAction(strings.Repeat("d", 30), "d")),
+			},
+		},
+	}
+	bubbles := []*linebot.BubbleContainer{bubble}
+	for len(bubbles) < maxFlexBubblesInCarousel+2 {
+		bubbles = append(bubbles, &linebot.BubbleContainer{Type: linebot.FlexContainerTypeBubble})
+	}
+	flex := linebot.NewFlexMessage(strings.Repeat("e", maxAltTextLength+10),
+		&linebot.CarouselContainer{Type: linebot.FlexContainerTypeCarousel, Contents: bubbles})
+
+	for _, message := range []linebot.SendingMessage{text, flex} {
+		if err := limitMessage(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name  string
+		value string
+		limit int
+	}{
+		{"text message", text.Text, maxTextMessageLength},
+		{"flex alt text", flex.AltText, maxAltTextLength},
+		{"hero action label", bubble.Hero.Action.(*linebot.URIAction).Label, maxActionLabelLength},
+		{"flex text", bubble.Body.Contents[0].(*linebot.TextComponent).Text, maxFlexTextLength},
+		{"flex button label", bubble.Body.Contents[1].(*linebot.ButtonComponent).Action.(*linebot.MessageAction).Label, maxActionLabelLength},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := utf8.RuneCountInString(tt.value); got != tt.limit {
+				t.Errorf("length = %d, want %d", got, tt.limit)
+			}
+		})
+	}
+	if got := len(flex.Contents.(*linebot.CarouselContainer).Contents); got != maxFlexBubblesInCarousel {
+		t.Errorf("bubbles = %d, want %d", got, maxFlexBubblesInCarousel)
+	}
+}
+
+func TestNewQuickReplyItems(t *testing.T) {
+	setupLimitTest()
+	button := func(label string, data string) *linebot.QuickReplyButton {
+		return linebot.NewQuickReplyButton("", linebot.NewPostbackAction(label, data, "", ""))
+	}
+	tests := []struct {
+		name    string
+		buttons []*linebot.QuickReplyButton
+		wantLen int
+	}{
+		{"keep valid buttons", []*linebot.QuickReplyButton{button("a", "a=1"), button("b", "a=2")}, 2},
+		{"drop buttons over count limit", func() (buttons []*linebot.QuickReplyButton) {
+			for i := 0; i < maxQuickReplyItems+3; i++ {
+				buttons = append(buttons, button("a", "a=1"))
+			}
+			return buttons
+		}(), maxQuickReplyItems},
+		{"drop button with long postback data", []*linebot.QuickReplyButton{
+			button("a", "a=1"), button("b", strings.Repeat("x", maxPostbackDataLength+1)),
+		}, 1},
+		{"keep camera button", []*linebot.QuickReplyButton{linebot.NewQuickReplyButton("", linebot.NewCameraAction("camera"))}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items := newQuickReplyItems(tt.buttons...)
+			if len(items.Items) != tt.wantLen {
+				t.Fatalf("items = %d, want %d", len(items.Items), tt.wantLen)
+			}
+		})
+	}
+
+	items := newQuickReplyItems(button(strings.Repeat("表", 30), "a=1"))
+	if got := utf8.RuneCountInString(items.Items[0].Action.(*linebot.PostbackAction).Label); got != maxActionLabelLength {
+		t.Errorf("label length = %d, want %d", got, maxActionLabelLength)
+	}
+}
+
+func TestPostbackDataOverLimit(t *testing.T) {
+	setupLimitTest()
+	data := postbackData(&Postback{Action: CodeQuery, Keyword: strings.Repeat("正妹", 100)})
+	if utf8.RuneCountInString(data) > maxPostbackDataLength {
+		t.Fatalf("data is %d characters, over limit", utf8.RuneCountInString(data))
+	}
+	pb, err := DecodePostback(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pb.Action != CodeHelp {
+		t.Errorf("action = %q, want %q", pb.Action, CodeHelp)
+	}
+}
+
+func TestArticleBubbleTitle(t *testing.T) {
+	setupLimitTest()
+	tests := []struct {
+		name         string
+		articleTitle string
+		want         string
+	}{
+		{"category and title", "[正妹] 標題", "標題"},
+		{"category only", "[正妹]", "[正妹]"},
+		{"category and space", "[正妹] ", "[正妹] "},
+		{"empty", "", "--"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bubble := getArticleBubble(models.ArticleDocument{ArticleTitle: tt.articleTitle}, false, "", defaultLocale)
+			if got := bubble.Body.Contents[1].(*linebot.TextComponent).Text; got != tt.want {
+				t.Errorf("title = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package bots
+
+import (
+	"os"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/mong0520/linebot-ptt-beauty/controllers"
+	"github.com/mong0520/linebot-ptt-beauty/models"
+	"github.com/mong0520/linebot-ptt-beauty/utils"
+)
+
+const (
+	CodeOnThisDay      ActionCode = "od"
+	CodeSubOnThisDay   ActionCode = "os"
+	CodeUnsubOnThisDay ActionCode = "ou"
+)
+
+func init() {
+	registerRoute(&Route{Code: CodeOnThisDay, Label: ActionOnThisDay, Triggers: []string{ActionOnThisDay},
+		Help: "往年的今天", MenuOrder: 70, Handler: actionOnThisDay})
+	registerRoute(&Route{Code: CodeSubOnThisDay, Label: ActionSubOnThisDay, Triggers: []string{ActionSubOnThisDay},
+		Help: "每天早上推播", MenuOrder: 80, Handler: actionSubscribeOnThisDay})
+	registerRoute(&Route{Code: CodeUnsubOnThisDay, Label: ActionUnsubOnThisDay, Triggers: []string{ActionUnsubOnThisDay},
+		Help: "取消推播", MenuOrder: 90, Handler: actionSubscribeOnThisDay})
+}
+
+// 每日推播歷史上的今天的時間 (台灣時間)
+var defaultOnThisDayPushTime = "08:00"
+
+func actionOnThisDay(event *linebot.Event, pb *Postback) {
+	settings := getSettings(event)
+	locale := getSettingsLocale(settings)
+	records, err := controllers.GetOnThisDay(meta.Collection, getPageSize(settings, maxCountOfCarousel), time.Now(), settings.Filter())
+	if err != nil || len(records) == 0 {
+		sendTextMessage(event, tr(locale, "on_this_day.empty"))
+		return
+	}
+	sortArticles(records, settings.Order)
+	carousel := newArticleCarousel(event, records)
+	sendArticles(event, carousel, tr(locale, "alt.on_this_day"))
+}
+
+func actionSubscribeOnThisDay(event *linebot.Event, pb *Postback) {
+	userFavorite := &controllers.UserFavorite{
+		UserId: event.Source.UserID,
+	}
+	enable := pb.Action == CodeSubOnThisDay
+	locale := getLocale(event)
+	if err := userFavorite.SetOnThisDay(meta, enable); err != nil {
+		sendTextMessage(event, tr(locale, "error.setting"))
+		return
+	}
+	if enable {
+		sendTextMessage(event, tr(locale, "on_this_day.subscribed"))
+	} else {
+		sendTextMessage(event, tr(locale, "on_this_day.unsubscribed"))
+	}
+}
+
+func startOnThisDayPush() {
+	pushTime := os.Getenv("OnThisDayPushTime")
+	if pushTime == "" {
+		pushTime = defaultOnThisDayPushTime
+	}
+	hour, minute, err := parseClock(pushTime)
+	if err != nil {
+		meta.Log.Println("Disable on this day push,", err)
+		return
+	}
+	runDaily("on this day push", hour, minute, pushOnThisDay)
+}
+
+func pushOnThisDay() {
+	userIds, err := controllers.GetOnThisDaySubscribers(meta)
+	if err != nil || len(userIds) == 0 {
+		return
+	}
+	allSettings, err := controllers.GetAllSettings(meta)
+	if err != nil {
+		meta.Log.Println("Unable to get settings, push with default settings", err)
+	}
+	now := time.Now()
+	cache := map[string][]models.ArticleDocument{}
+	for _, userId := range userIds {
+		settings := getUserSettings(allSettings, userId)
+		key := getSettingsKey(settings)
+		records, ok := cache[key]
+		if !ok {
+			records, err = controllers.GetOnThisDay(meta.Collection, getPageSize(settings, maxCountOfCarousel), now, settings.Filter())
+			if err != nil {
+				meta.Log.Println("No on this day records to push", err)
+			}
+			sortArticles(records, settings.Order)
+			cache[key] = records
+		}
+		if len(records) == 0 {
+			continue
+		}
+		locale := getSettingsLocale(settings)
+		carousel := &articleCarousel{userId: userId, records: records, locale: locale}
+		message := renderArticles(carousel, tr(locale, "alt.on_this_day"))
+		if err := pushMessage(userId, message); err != nil {
+			meta.Log.Println("Push on this day fail", utils.RedactID(userId), err)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package bots
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mong0520/linebot-ptt-beauty/controllers"
+	"github.com/mong0520/linebot-ptt-beauty/models"
+)
+
+// 檢查孤兒最愛的間隔，以及找不到多久之後從最愛移除；
+// 期間內最愛列表會顯示已刪除的卡片，爬蟲補抓回來就會恢復
+var orphanInterval = 6 * time.Hour
+var orphanGracePeriod = 7 * 24 * time.Hour
+
+// 一次有超過一半的最愛找不到原文，多半是 ptt.beauty 被清空或爬蟲出了問題，
+// 而不是文章真的被刪除，這時候不記錄也不移除；孤兒太少時比例沒有意義，不檢查
+var maxOrphanRatio = 0.5
+var minOrphansForRatio = 10
+
+func startOrphanJob() {
+	runEvery("orphan favorites", orphanInterval, pruneOrphanFavorites)
+}
+
+// pruneOrphanFavorites 記錄不在 ptt.beauty 的最愛，超過 orphanGracePeriod 的從最愛移除
+func pruneOrphanFavorites() {
+	articleCount, err := controllers.CountArticles(meta)
+	if err != nil {
+		meta.Log.Println("Count articles fail", err)
+		return
+	}
+	articleIds, favoriteCount, err := controllers.FindOrphanFavorites(meta)
+	if err != nil {
+		meta.Log.Println("Find orphan favorites fail", err)
+		return
+	}
+	if err := checkOrphanSafety(articleCount, favoriteCount, len(articleIds)); err != nil {
+		meta.Log.Println("Skip orphan favorites:", err)
+		return
+	}
+	now := time.Now()
+	if err := controllers.MarkOrphanFavorites(meta, articleIds, now); err != nil {
+		return
+	}
+	expired, err := controllers.GetExpiredOrphans(meta, now.Add(-orphanGracePeriod))
+	if err != nil {
+		meta.Log.Println("Get expired orphan favorites fail", err)
+		return
+	}
+	if len(expired) == 0 {
+		return
+	}
+	users, groups, err := controllers.PruneFavorites(meta, expired)
+	if err != nil {
+		return
+	}
+	meta.Log.Printf("Prune %d orphan favorites from %d users and %d groups\n", len(expired), users, groups)
+}
+
+// checkOrphanSafety 是移除孤兒最愛前的保險，文章集合是空的或孤兒比例太高時回傳錯誤
+func checkOrphanSafety(articleCount int, favoriteCount int, orphanCount int) error {
+	if articleCount == 0 {
+		return errors.New("article collection is empty")
+	}
+	if orphanCount < minOrphansForRatio || favoriteCount == 0 {
+		return nil
+	}
+	if ratio := float64(orphanCount) / float64(favoriteCount); ratio > maxOrphanRatio {
+		return fmt.Errorf("%d of %d favorites are missing (%.0f%%), over limit %.0f%%",
+			orphanCount, favoriteCount, ratio*100, maxOrphanRatio*100)
+	}
+	return nil
+}
+
+// isMissingArticle 判斷是否為 GetFavoriteArticles 補上的已刪除文章
+func isMissingArticle(record models.ArticleDocument) bool {
+	return record.ID == ""
+}
+
+// fillMissingArticles 替已刪除的文章填上標題與連結，並在備註註明會自動移除
+func fillMissingArticles(records []models.ArticleDocument, notes map[string]string, locale string) {
+	for idx := range records {
+		if !isMissingArticle(records[idx]) {
+			continue
+		}
+		records[idx].ArticleTitle = tr(locale, "orphan.title")
+		records[idx].URL = getArticleURL(records[idx])
+		notes[records[idx].ArticleID] = tr(locale, "orphan.note")
+	}
+}
@@ -0,0 +1,31 @@
+package bots
+
+import "testing"
+
+func TestCheckOrphanSafety(t *testing.T) {
+	tests := []struct {
+		name          string
+		articleCount  int
+		favoriteCount int
+		orphanCount   int
+		wantErr       bool
+	}{
+		{"empty article collection", 0, 100, 100, true},
+		{"empty collection without orphans", 0, 0, 0, true},
+		{"no orphans", 1000, 100, 0, false},
+		{"few orphans", 1000, 100, 20, false},
+		{"exactly at ratio", 1000, 100, 50, false},
+		{"over ratio", 1000, 100, 51, true},
+		{"all missing", 1000, 100, 100, true},
+		{"too few orphans to check ratio", 1000, 12, 9, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkOrphanSafety(tt.articleCount, tt.favoriteCount, tt.orphanCount)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkOrphanSafety(%d, %d, %d) = %v, wantErr %v",
+					tt.articleCount, tt.favoriteCount, tt.orphanCount, err, tt.wantErr)
+			}
+		})
+	}
+}
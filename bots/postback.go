@@ -0,0 +1,228 @@
+package bots
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ActionCode 是 postback 裡固定不變的動作代碼，和顯示用的 label 分開，
+// 改 label 不會讓使用者聊天記錄裡的舊按鈕失效
+type ActionCode string
+
+const postbackVersion = "2"
+
+// 簽章取 HMAC-SHA256 的前 12 bytes，base64 後是 16 個字
+const postbackSignatureBytes = 12
+
+var postbackSecret []byte
+
+var ErrInvalidPostbackSignature = errors.New("invalid postback signature")
+
+// 基本功能的代碼，其他功能的代碼定義在各自的檔案裡，一旦發出去就不能再改
+const (
+	CodeHelp       ActionCode = "mn"
+	CodeSearchTips ActionCode = "st"
+	CodeQuery      ActionCode = "q"
+	CodeNewest     ActionCode = "nw"
+	CodeRandom     ActionCode = "rd"
+	CodeDailyHot   ActionCode = "hd"
+	CodeMonthlyHot ActionCode = "hm"
+	CodeYearHot    ActionCode = "hy"
+	// CodeAddFavorite 是舊按鈕用的代碼，原本是切換，現在和 CodeFavoriteAdd 一樣只會加入，
+	// 重複送達也不會把剛加入的又移除
+	CodeAddFavorite    ActionCode = "fa"
+	CodeFavoriteAdd    ActionCode = "fd"
+	CodeFavoriteRemove ActionCode = "fr"
+	CodeShowFavorite   ActionCode = "fl"
+	CodeAllImage       ActionCode = "im"
+)
+
+// legacyActions 舊版 postback 直接拿 label 當 action，解碼時轉成代碼。舊版沒有簽章，
+// 只有原本就存在的按鈕 (Route.LegacyLabels) 會填進來，其他動作一律要有簽章
+var legacyActions = map[string]ActionCode{}
+
+// knownActions 記錄所有註冊過的代碼，由 registerRoute 填入
+var knownActions = map[ActionCode]bool{}
+
+// Postback 是解碼後的 postback 內容，沒用到的欄位保持零值。
+// 使用者身分一律從 event.Source 取得，不放在 postback 裡
+type Postback struct {
+	Action    ActionCode
+	Page      int
+	Period    int
+	ArticleID string
+	Author    string
+	Keyword   string
+	Category  string
+	// Weekday 1 到 7 代表星期一到星期日，0 代表沒有設定
+	Weekday int
+	// Collection 是收藏夾的 id
+	Collection string
+	// Sort 是最愛的排序方式，空字串代表依加入時間
+	Sort string
+	// Share 是收藏夾的分享碼
+	Share string
+	// Setting 與 Value 是要修改的設定與新的值
+	Setting string
+	Value   string
+}
+
+var errNoPostbackSecret = errors.New("PostbackSecret and ChannelSecret are both empty, unable to sign postback")
+
+// initPostbackSecret 設定簽章用的金鑰，沒有設定 PostbackSecret 時使用 ChannelSecret，
+// 兩個都沒有時回傳錯誤，空的金鑰等於任何人都能偽造 postback
+func initPostbackSecret() error {
+	secret := os.Getenv("PostbackSecret")
+	if secret == "" {
+		secret = os.Getenv("ChannelSecret")
+	}
+	if secret == "" {
+		return errNoPostbackSecret
+	}
+	postbackSecret = []byte(secret)
+	return nil
+}
+
+func signPostback(payload string) string {
+	mac := hmac.New(sha256.New, postbackSecret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:postbackSignatureBytes])
+}
+
+// Encode 編成 "v=2&a=nw&p=1&s=<簽章>" 這種精簡格式，超過 Line 的長度上限時回傳錯誤
+func (p *Postback) Encode() (data string, err error) {
+	parts := []string{"v=" + postbackVersion, "a=" + string(p.Action)}
+	if p.Page != 0 {
+		parts = append(parts, "p="+strconv.Itoa(p.Page))
+	}
+	if p.Period != 0 {
+		parts = append(parts, "t="+strconv.Itoa(p.Period))
+	}
+	if p.ArticleID != "" {
+		parts = append(parts, "id="+url.QueryEscape(p.ArticleID))
+	}
+	if p.Author != "" {
+		parts = append(parts, "au="+url.QueryEscape(p.Author))
+	}
+	if p.Keyword != "" {
+		parts = append(parts, "k="+url.QueryEscape(p.Keyword))
+	}
+	if p.Category != "" {
+		parts = append(parts, "c="+url.QueryEscape(p.Category))
+	}
+	if p.Weekday != 0 {
+		parts = append(parts, "w="+strconv.Itoa(p.Weekday))
+	}
+	if p.Collection != "" {
+		parts = append(parts, "f="+url.QueryEscape(p.Collection))
+	}
+	if p.Sort != "" {
+		parts = append(parts, "o="+url.QueryEscape(p.Sort))
+	}
+	if p.Share != "" {
+		parts = append(parts, "sh="+url.QueryEscape(p.Share))
+	}
+	if p.Setting != "" {
+		parts = append(parts, "n="+url.QueryEscape(p.Setting))
+	}
+	if p.Value != "" {
+		parts = append(parts, "x="+url.QueryEscape(p.Value))
+	}
+	data = strings.Join(parts, "&")
+	data = data + "&s=" + signPostback(data)
+	if utf8.RuneCountInString(data) > maxPostbackDataLength {
+		return "", fmt.Errorf("postback data of %s is %d characters, over limit %d",
+			p.Action, utf8.RuneCountInString(data), maxPostbackDataLength)
+	}
+	return data, nil
+}
+
+// DecodePostback 解析新版或舊版 (action=<label>&...) 的 postback，新版的簽章不符時回傳
+// ErrInvalidPostbackSignature。舊版沒有簽章，只接受 legacyActions 裡的動作，其中的 user_id 一律忽略
+func DecodePostback(data string) (p *Postback, err error) {
+	values, err := url.ParseQuery(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid postback: %v", err)
+	}
+	if values.Get("v") == postbackVersion {
+		idx := strings.LastIndex(data, "&s=")
+		if idx < 0 || !hmac.Equal([]byte(data[idx+3:]), []byte(signPostback(data[:idx]))) {
+			return nil, ErrInvalidPostbackSignature
+		}
+		p = &Postback{
+			Action:     ActionCode(values.Get("a")),
+			ArticleID:  values.Get("id"),
+			Author:     values.Get("au"),
+			Keyword:    values.Get("k"),
+			Category:   values.Get("c"),
+			Collection: values.Get("f"),
+			Sort:       values.Get("o"),
+			Share:      values.Get("sh"),
+			Setting:    values.Get("n"),
+			Value:      values.Get("x"),
+		}
+		if p.Page, err = getIntValue(values, "p"); err != nil {
+			return nil, err
+		}
+		if p.Period, err = getIntValue(values, "t"); err != nil {
+			return nil, err
+		}
+		if p.Weekday, err = getIntValue(values, "w"); err != nil {
+			return nil, err
+		}
+	} else {
+		code, ok := legacyActions[values.Get("action")]
+		if !ok {
+			return nil, fmt.Errorf("unknown legacy postback action %q", values.Get("action"))
+		}
+		p = &Postback{
+			Action:    code,
+			ArticleID: values.Get("article_id"),
+			Author:    values.Get("author"),
+		}
+		if p.Page, err = getIntValue(values, "page"); err != nil {
+			return nil, err
+		}
+		if p.Period, err = getIntValue(values, "period"); err != nil {
+			return nil, err
+		}
+	}
+	if !knownActions[p.Action] {
+		return nil, fmt.Errorf("unknown postback action %q", p.Action)
+	}
+	if p.Page < 0 {
+		p.Page = 0
+	}
+	return p, nil
+}
+
+func getIntValue(values url.Values, key string) (int, error) {
+	value := values.Get(key)
+	if value == "" {
+		return 0, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid postback field %s=%q", key, value)
+	}
+	return i, nil
+}
+
+// postbackData 產生按鈕用的 data。超過長度上限時記錄下來，改成打開選單的按鈕，
+// 避免送出 Line 會拒絕的 data
+func postbackData(p *Postback) string {
+	data, err := p.Encode()
+	if err != nil {
+		meta.Log.Println(err)
+		data, _ = (&Postback{Action: CodeHelp}).Encode()
+	}
+	return data
+}
@@ -0,0 +1,135 @@
+package bots
+
+import (
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPostbackRoundTrip(t *testing.T) {
+	postbackSecret = []byte("test-secret")
+	tests := []struct {
+		name string
+		pb   Postback
+	}{
+		{"action only", Postback{Action: CodeNewest}},
+		{"page and period", Postback{Action: CodeDailyHot, Page: 3, Period: oneDayInSec}},
+		{"escaped keyword", Postback{Action: CodeQuery, Keyword: "新垣 結衣&s=x", Category: "正妹"}},
+		{"article and author", Postback{Action: CodeFavoriteAdd, ArticleID: "M.1520000000.A.1F2", Author: "ckpot"}},
+		{"all remaining fields", Postback{Action: CodeHelp, Weekday: 7, Collection: "c1", Sort: "push", Share: "K7PX3M", Setting: "locale", Value: "ja"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.pb.Encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := DecodePostback(data)
+			if err != nil {
+				t.Fatalf("DecodePostback(%q): %v", data, err)
+			}
+			if !reflect.DeepEqual(*got, tt.pb) {
+				t.Errorf("DecodePostback = %+v, want %+v", *got, tt.pb)
+			}
+		})
+	}
+}
+
+func TestEncodePostbackOverLimit(t *testing.T) {
+	postbackSecret = []byte("test-secret")
+	pb := &Postback{Action: CodeQuery, Keyword: strings.Repeat("k", maxPostbackDataLength)}
+	if _, err := pb.Encode(); err == nil {
+		t.Fatal("expected error for data over limit")
+	}
+}
+
+func TestDecodePostbackRejects(t *testing.T) {
+	postbackSecret = []byte("test-secret")
+	valid, _ := (&Postback{Action: CodeNewest, Page: 1}).Encode()
+	postbackSecret = []byte("other-secret")
+	otherSecret, _ := (&Postback{Action: CodeNewest, Page: 1}).Encode()
+	postbackSecret = []byte("test-secret")
+	unknown, _ := (&Postback{Action: "zz"}).Encode()
+
+	tests := []struct {
+		name          string
+		data          string
+		wantSignature bool
+	}{
+		{"tampered field", strings.Replace(valid, "p=1", "p=2", 1), true},
+		{"missing signature", valid[:strings.LastIndex(valid, "&s=")], true},
+		{"signed with another secret", otherSecret, true},
+		{"unknown signed action", unknown, false},
+		{"unsigned new route via legacy format", "action=" + url.QueryEscape(ActionDeleteData), false},
+		{"unsigned share via legacy format", "action=" + url.QueryEscape(ActionCopyShare), false},
+		{"unknown legacy label", "action=nope", false},
+		{"invalid legacy page", "action=" + url.QueryEscape(ActionNewest) + "&page=abc", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb, err := DecodePostback(tt.data)
+			if err == nil {
+				t.Fatalf("DecodePostback(%q) = %+v, want error", tt.data, pb)
+			}
+			if (err == ErrInvalidPostbackSignature) != tt.wantSignature {
+				t.Errorf("err = %v, want signature error %v", err, tt.wantSignature)
+			}
+		})
+	}
+}
+
+func TestDecodeLegacyPostback(t *testing.T) {
+	tests := []struct {
+		data string
+		want Postback
+	}{
+		{"action=" + url.QueryEscape(ActionNewest) + "&page=2", Postback{Action: CodeNewest, Page: 2}},
+		{"action=" + url.QueryEscape(ActionAllImage) + "&article_id=M.1.A.2&page=-1", Postback{Action: CodeAllImage, ArticleID: "M.1.A.2"}},
+		{"action=" + url.QueryEscape(ActionAddFavorite) + "&user_id=Uother&article_id=M.1.A.2", Postback{Action: CodeAddFavorite, ArticleID: "M.1.A.2"}},
+		{"action=" + url.QueryEscape(ActonShowFav) + "&user_id=Uother&page=0", Postback{Action: CodeShowFavorite}},
+		{"action=" + url.QueryEscape(ActionDailyHot) + "&period=86400", Postback{Action: CodeDailyHot, Period: 86400}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			got, err := DecodePostback(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("DecodePostback = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInitPostbackSecret(t *testing.T) {
+	tests := []struct {
+		name           string
+		postbackSecret string
+		channelSecret  string
+		want           string
+		wantErr        bool
+	}{
+		{"postback secret first", "pb", "channel", "pb", false},
+		{"fall back to channel secret", "", "channel", "channel", false},
+		{"fail without any secret", "", "", "", true},
+	}
+	defer os.Setenv("PostbackSecret", os.Getenv("PostbackSecret"))
+	defer os.Setenv("ChannelSecret", os.Getenv("ChannelSecret"))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			postbackSecret = nil
+			os.Setenv("PostbackSecret", tt.postbackSecret)
+			os.Setenv("ChannelSecret", tt.channelSecret)
+			err := initPostbackSecret()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(postbackSecret) != tt.want {
+				t.Errorf("postbackSecret = %q, want %q", postbackSecret, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package bots
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/mong0520/linebot-ptt-beauty/controllers"
+)
+
+const CodeDeleteData ActionCode = "xd"
+
+// DeleteDataCommand 刪除自己在機器人裡的所有資料，只接受中文指令
+const DeleteDataCommand string = "刪除我的資料"
+
+func init() {
+	registerRoute(&Route{Code: CodeDeleteData, Label: ActionDeleteData, Help: "刪除我的資料", Handler: actionDeleteData})
+}
+
+// 封鎖機器人超過多久就刪除資料，可用 UserRetentionDays 設定；推播記錄只保留 deliveryRetention。
+// 沒有封鎖的使用者即使很久沒互動也不會自動刪除，要刪除請使用者自己用「刪除我的資料」
+var defaultUserRetentionDays = 180
+var deliveryRetention = 90 * 24 * time.Hour
+
+// privacyTextHandler 處理刪除資料的指令，先請使用者確認，回傳是否有處理
+func privacyTextHandler(event *linebot.Event, message string) bool {
+	if strings.TrimSpace(message) != DeleteDataCommand {
+		return false
+	}
+	locale := getLocale(event)
+	if getGroupId(event.Source) != "" {
+		sendTextMessage(event, tr(locale, "privacy.private_only"))
+		return true
+	}
+	label := actionLabel(CodeDeleteData, locale)
+	data := postbackData(&Postback{Action: CodeDeleteData})
+	reply := linebot.NewTextMessage(tr(locale, "privacy.confirm")).WithQuickReplies(newQuickReplyItems(
+		linebot.NewQuickReplyButton("", linebot.NewPostbackAction(label, data, "", label)),
+	))
+	replyMessage(event, reply)
+	return true
+}
+
+func actionDeleteData(event *linebot.Event, pb *Postback) {
+	if getGroupId(event.Source) != "" || event.Source.UserID == "" {
+		return
+	}
+	// 設定也會被刪掉，要先取出語言
+	locale := getLocale(event)
+	if err := controllers.DeleteUserData(meta, event.Source.UserID); err != nil {
+		sendTextMessage(event, tr(locale, "privacy.failed"))
+		return
+	}
+	sendTextMessage(event, tr(locale, "privacy.deleted"))
+}
+
+func getUserRetention() time.Duration {
+	days := defaultUserRetentionDays
+	if value := os.Getenv("UserRetentionDays"); value != "" {
+		if d, err := strconv.Atoi(value); err == nil && d > 0 {
+			days = d
+		} else {
+			meta.Log.Println("Invalid UserRetentionDays", value)
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func startRetentionJob() {
+	runDaily("data retention", 4, 0, purgeExpiredData)
+}
+
+// purgeExpiredData 刪除封鎖機器人太久的使用者資料，以及過期的推播記錄
+func purgeExpiredData() {
+	now := time.Now()
+	userIds, err := controllers.GetExpiredUserIds(meta, now.Add(-getUserRetention()))
+	if err != nil {
+		meta.Log.Println("Unable to get expired users", err)
+		return
+	}
+	deleted := 0
+	for _, userId := range userIds {
+		if err := controllers.DeleteUserData(meta, userId); err != nil {
+			continue
+		}
+		deleted++
+	}
+	count, err := controllers.PurgeDeliveries(meta, now.Add(-deliveryRetention))
+	if err != nil {
+		return
+	}
+	meta.Log.Printf("Delete data of %d inactive users and %d deliveries\n", deleted, count)
+}
@@ -2,13 +2,9 @@ package bots
 
 import (
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
-	"net/url"
 	"os"
-	"os/exec"
-	"strconv"
 	"strings"
 
 	"github.com/line/line-bot-sdk-go/linebot"
@@ -34,37 +30,108 @@ var SSLPrivateKeyPath = "/etc/nginx/ssl/api.nt1.me.key"
 const (
 	DefaultTitle string = "💋表特看看"
 
-	// 應該把 action 和 lable 分開
-	ActionQuery       string = "一般查詢"
-	ActionNewest      string = "🎊 最新表特"
-	ActionDailyHot    string = "📈 本日熱門"
-	ActionMonthlyHot  string = "🔥 近期熱門" //改成近期隨機, 先選出100個，然後隨機吐10筆
-	ActionYearHot     string = "🏆 年度熱門"
-	ActionRandom      string = "👩 隨機十連抽"
-	ActionAddFavorite string = "加入最愛"
-	ActionClick       string = "👉 點我打開"
-	ActionHelp        string = "表特選單"
-	ActionAllImage    string = "👁️ 預覽圖片"
-	ActonShowFav      string = "❤️ 我的最愛"
-	ActonRunCC        string = "/cc"
+	// 繁體中文的按鈕名稱，也是觸發文字與舊版 postback 的 label，其他語言在 i18n.go
+	ActionQuery             string = "一般查詢"
+	ActionNewest            string = "🎊 最新表特"
+	ActionDailyHot          string = "📈 本日熱門"
+	ActionMonthlyHot        string = "🔥 近期熱門" //改成近期隨機, 先選出100個，然後隨機吐10筆
+	ActionYearHot           string = "🏆 年度熱門"
+	ActionRandom            string = "👩 隨機十連抽"
+	ActionAddFavorite       string = "加入最愛"
+	ActionFavoriteAdd       string = "💛 加入最愛"
+	ActionFavoriteRemove    string = "❤️ 移除最愛"
+	ActionClick             string = "👉 點我打開"
+	ActionHelp              string = "表特選單"
+	ActionAllImage          string = "👁️ 預覽圖片"
+	ActonShowFav            string = "❤️ 我的最愛"
+	ActionAdmin             string = "/admin"
+	ActionOnThisDay         string = "📅 歷史上的今天"
+	ActionSubOnThisDay      string = "🔔 每日推播"
+	ActionUnsubOnThisDay    string = "🔕 取消推播"
+	ActionWeeklyTopFavorite string = "🏅 本週最愛"
+	ActionTopFavorite       string = "💯 最愛排行"
+	ActionTopAuthor         string = "✍️ 作者排行"
+	ActionAuthor            string = "📚 作者文章"
+	ActionMore              string = "⋯ 更多"
+	ActionComments          string = "💬 看推文"
+	ActionSummary           string = "📝 看內文"
+	ActionSearchTips        string = "🔍 搜尋教學"
+	ActionSubscription      string = "📬 我的訂閱"
+	ActionSubscribe         string = "📬 訂閱作者"
+	ActionUnsubscribe       string = "取消訂閱"
+	ActionDigest            string = "📰 熱門摘要"
+	ActionDailyDigest       string = "⏰ 每日摘要"
+	ActionWeeklyDigest      string = "📆 每週摘要"
+	ActionCancelDigest      string = "取消摘要"
+	ActionCollections       string = "📁 收藏夾"
+	ActionChooseCollection  string = "📁 移到收藏夾"
+	ActionCopyShare         string = "📥 全部加入最愛"
+	ActionDeleteData        string = "🗑 確定刪除"
+	ActionSettings          string = "⚙️ 個人設定"
 
 	ModeHttp  string = "http"
 	ModeHttps string = "https"
 	AltText   string = "正妹只在手機上"
 )
 
+func init() {
+	// 舊版就有的按鈕保留 LegacyLabels，聊天記錄裡沒有簽章的舊按鈕仍然可以用
+	registerRoute(&Route{Code: CodeHelp, Label: ActionHelp, LegacyLabels: []string{ActionHelp}, Triggers: []string{ActionHelp}, Help: "功能選單",
+		Handler: actionHelp})
+	registerRoute(&Route{Code: CodeSearchTips, Label: ActionSearchTips, Triggers: []string{ActionSearchTips}, Help: "搜尋教學",
+		Handler: func(event *linebot.Event, pb *Postback) { sendTextMessage(event, getSearchTips(getLocale(event))) }})
+	registerRoute(&Route{Code: CodeQuery, Label: ActionQuery, LegacyLabels: []string{ActionQuery}, Help: "依時間查詢熱門",
+		Handler: actionGeneral})
+	registerRoute(&Route{Code: CodeNewest, Label: ActionNewest, LegacyLabels: []string{ActionNewest}, Triggers: []string{ActionNewest}, Help: "最新文章",
+		MenuOrder: 10, Handler: actionNewest})
+	registerRoute(&Route{Code: CodeRandom, Label: ActionRandom, LegacyLabels: []string{ActionRandom}, Triggers: []string{ActionRandom}, Help: "隨機十篇",
+		MenuOrder: 20, Handler: actionGeneral})
+	registerRoute(&Route{Code: CodeShowFavorite, Label: ActonShowFav, LegacyLabels: []string{ActonShowFav}, Triggers: []string{ActonShowFav}, Help: "收藏的照片",
+		MenuOrder: 30, Handler: actionShowFavorite})
+	registerRoute(&Route{Code: CodeDailyHot, Label: ActionDailyHot, LegacyLabels: []string{ActionDailyHot}, Triggers: []string{ActionDailyHot}, Help: "今天最多推",
+		MenuOrder: 40, Handler: withPeriod(oneDayInSec)})
+	registerRoute(&Route{Code: CodeMonthlyHot, Label: ActionMonthlyHot, LegacyLabels: []string{ActionMonthlyHot}, Triggers: []string{ActionMonthlyHot}, Help: "這週最多推",
+		MenuOrder: 50, Handler: withPeriod(oneWeekInSec)})
+	registerRoute(&Route{Code: CodeYearHot, Label: ActionYearHot, LegacyLabels: []string{ActionYearHot}, Triggers: []string{ActionYearHot}, Help: "今年最多推",
+		MenuOrder: 60, Handler: withPeriod(oneYearInSec)})
+	registerRoute(&Route{Code: CodeAllImage, Label: ActionAllImage, LegacyLabels: []string{ActionAllImage}, Help: "預覽文章圖片",
+		Handler: actionAllImage})
+	registerRoute(&Route{Code: CodeAddFavorite, Label: ActionAddFavorite, LegacyLabels: []string{ActionAddFavorite}, Help: "加入最愛",
+		Handler: actinoAddFavorite})
+	registerRoute(&Route{Code: CodeFavoriteAdd, Label: ActionFavoriteAdd, Help: "加入最愛",
+		Handler: actinoAddFavorite})
+	registerRoute(&Route{Code: CodeFavoriteRemove, Label: ActionFavoriteRemove, Help: "移除最愛",
+		Handler: actinoAddFavorite})
+}
+
 func InitLineBot(m *models.Model) {
 
 	var err error
 	meta = m
-	secret := os.Getenv("ChannelSecret")
-	token := os.Getenv("ChannelAccessToken")
-	bot, err = linebot.New(secret, token)
+	bot, err = newLineClient()
 	if err != nil {
 		log.Println(err)
 	}
+	if err := initPostbackSecret(); err != nil {
+		m.Log.Fatalln("Unable to init postback secret", err)
+	}
+	loadConfig()
+	initGroupTriggerPrefix()
+	if err := controllers.EnsureIndexes(m); err != nil {
+		m.Log.Println("Unable to ensure indexes", err)
+	}
+	if err := controllers.MigrateFavorites(m); err != nil {
+		m.Log.Println("Unable to migrate favorites", err)
+	}
 	//log.Println("Bot:", bot, " err:", err)
+	startOnThisDayPush()
+	startLeaderboardJob()
+	startSubscriptionJob()
+	startDigestJob()
+	startOrphanJob()
+	startRetentionJob()
 	http.HandleFunc("/callback", callbackHandler)
+	http.HandleFunc("/export", exportHandler)
 	port := os.Getenv("PORT")
 	//port := "8080"
 	addr := fmt.Sprintf(":%s", port)
@@ -85,6 +152,13 @@ func InitLineBot(m *models.Model) {
 	}
 }
 
+// loadConfig 讀取可以在執行中重新載入的設定，/admin reload config 也會呼叫
+func loadConfig() {
+	setArticleRenderer(os.Getenv("ArticleRenderer"))
+	meta.Log.Printf("Article Renderer = %s\n", getArticleRenderer())
+	loadAdminUserIds()
+}
+
 func callbackHandler(w http.ResponseWriter, r *http.Request) {
 	events, err := bot.ParseRequest(r)
 
@@ -99,248 +173,210 @@ func callbackHandler(w http.ResponseWriter, r *http.Request) {
 
 	for _, event := range events {
 		if event.Type == linebot.EventTypeMessage {
-			userDisplayName := getUserNameById(event.Source.UserID)
-			meta.Log.Printf("Receieve Event Type = %s from User [%s](%s), or Room [%s] or Group [%s]\n",
-				event.Type, userDisplayName, event.Source.UserID, event.Source.RoomID, event.Source.GroupID)
+			meta.Log.Printf("Receieve Event Type = %s from User (%s), or Room [%s] or Group [%s]\n", event.Type,
+				utils.RedactID(event.Source.UserID), utils.RedactID(event.Source.RoomID), utils.RedactID(event.Source.GroupID))
 
 			switch message := event.Message.(type) {
 			case *linebot.TextMessage:
 				meta.Log.Println("Text = ", message.Text)
 				textHander(event, message.Text)
+			case *linebot.FileMessage:
+				fileHandler(event, message)
 			default:
 				meta.Log.Println("Unimplemented handler for event type ", event.Type)
 			}
 		} else if event.Type == linebot.EventTypePostback {
+			// 舊版 postback 裡有 user_id，不記錄原始內容，解碼後只記錄動作
 			meta.Log.Println("got a postback event")
-			meta.Log.Println(event.Postback.Data)
+			if isGroupDisabled(event) {
+				meta.Log.Println("Ignore postback from disabled group", utils.RedactID(getGroupId(event.Source)))
+				continue
+			}
 			postbackHandler(event)
 
 		} else {
-			meta.Log.Printf("got a %s event\n", event.Type)
+			eventHandler(event)
 		}
 	}
 }
 
-func actionHandler(event *linebot.Event, action string, values url.Values) {
-	switch action {
-	case ActionNewest:
-		actionNewest(event, values)
-	case ActionAllImage:
-		actionAllImage(event, values)
-	case ActionQuery, ActionRandom:
-		actionGeneral(event, action, values)
-	case ActionAddFavorite:
-		actinoAddFavorite(event, action, values)
-	case ActonShowFav:
-		actionShowFavorite(event, action, values)
-	default:
-		meta.Log.Println("Unimplement action handler", action)
+// actinoAddFavorite 依 postback 的代碼加入或移除最愛，都是資料庫端的原子操作，
+// 重複送達的 postback 不會把剛加入的又移除；舊版的切換按鈕一律當作加入
+func actinoAddFavorite(event *linebot.Event, pb *Postback) {
+	articleId := pb.ArticleID
+	if articleId == "" {
+		meta.Log.Println("Unable to get article id", pb)
+		return
 	}
-}
-
-func actinoAddFavorite(event *linebot.Event, action string, values url.Values) {
-	toggleMessage := ""
-	userId := values.Get("user_id")
-	newFavoriteArticle := values.Get("article_id")
-	userFavorite := &controllers.UserFavorite{
-		UserId:    userId,
-		Favorites: []string{newFavoriteArticle},
-	}
-	latestFavArticles := []string{}
-	if record, err := userFavorite.Get(meta); err != nil {
-		meta.Log.Println("User data is not created, create a new one")
-		userFavorite.Add(meta)
-		latestFavArticles = append(latestFavArticles, newFavoriteArticle)
+	if groupId := getGroupId(event.Source); groupId != "" {
+		actionAddGroupFavorite(event, groupId, pb)
+		return
+	}
+	userFavorite := &controllers.UserFavorite{UserId: event.Source.UserID}
+	added := pb.Action != CodeFavoriteRemove
+	var err error
+	if added {
+		_, err = userFavorite.AddFavorite(meta, articleId)
 	} else {
-		meta.Log.Println("Record found, update it", record)
-		oldRecords := record.Favorites
-		if exist, idx := utils.InArray(newFavoriteArticle, oldRecords); exist == true {
-			meta.Log.Println(newFavoriteArticle, "已存在，移除")
-			oldRecords = utils.RemoveStringItem(oldRecords, idx)
-			toggleMessage = "已從最愛中移除"
-		} else {
-			oldRecords = append(oldRecords, newFavoriteArticle)
-			toggleMessage = "已新增至最愛"
-		}
-		latestFavArticles = oldRecords
-		userFavorite.Favorites = oldRecords
-		userFavorite.Update(meta)
+		_, err = userFavorite.RemoveFavorite(meta, articleId)
 	}
-	sendTextMessage(event, toggleMessage)
+	locale := getLocale(event)
+	if err != nil {
+		sendTextMessage(event, tr(locale, "error.setting"))
+		return
+	}
+	if added {
+		sendCollectionChoice(event, tr(locale, "favorite.added", FavoriteNoteCommand), articleId)
+		return
+	}
+	sendTextMessage(event, tr(locale, "favorite.removed"))
 }
 
-func actionShowFavorite(event *linebot.Event, action string, values url.Values) {
-	columnCount := 9
-	userId := values.Get("user_id")
-	userFavorite := &controllers.UserFavorite{
-		UserId:    userId,
-		Favorites: []string{},
+// actionAddGroupFavorite 群組裡的最愛是大家共用的，回覆時註明是誰加入或移除
+func actionAddGroupFavorite(event *linebot.Event, groupId string, pb *Postback) {
+	group := &controllers.Group{GroupId: groupId}
+	added := pb.Action != CodeFavoriteRemove
+	var err error
+	if added {
+		_, err = group.AddFavorite(meta, pb.ArticleID, event.Source.UserID)
+	} else {
+		_, err = group.RemoveFavorite(meta, pb.ArticleID)
 	}
-
-	if currentPage, err := strconv.Atoi(values.Get("page")); err != nil {
-		meta.Log.Println("Unable to parse parameters", values)
+	locale := getLocale(event)
+	if err != nil {
+		sendTextMessage(event, tr(locale, "error.setting"))
+		return
+	}
+	name := getMemberName(event.Source)
+	if added {
+		sendTextMessage(event, tr(locale, "group.favorite_added", name))
 	} else {
-		userData, _ := userFavorite.Get(meta)
-
-		// reverse slice
-		for i := len(userData.Favorites)/2 - 1; i >= 0; i-- {
-			opp := len(userData.Favorites) - 1 - i
-			userData.Favorites[i], userData.Favorites[opp] = userData.Favorites[opp], userData.Favorites[i]
-		}
-
-		startIdx := currentPage * columnCount
-		endIdx := startIdx + columnCount
-		lastPage := false
-		if endIdx > len(userData.Favorites)-1 || startIdx > endIdx {
-			endIdx = len(userData.Favorites)
-			lastPage = true
-		}
+		sendTextMessage(event, tr(locale, "group.favorite_removed", name))
+	}
+}
 
-		fmt.Println("Start Index", startIdx)
-		fmt.Println("End Index", endIdx)
-		fmt.Println("Total Length", len(userData.Favorites))
+func actionShowFavorite(event *linebot.Event, pb *Postback) {
+	settings := getSettings(event)
+	columnCount := getPageSize(settings, 9)
+	currentPage := pb.Page
+	// 沒有指定排序時依個人設定的排序
+	sortBy := pb.Sort
+	if sortBy == "" {
+		sortBy = settings.Order
+	}
+	locale := getSettingsLocale(settings)
+	favorites, notes := getFavorites(event, pb.Collection)
+	if len(favorites) == 0 {
+		sendTextMessage(event, tr(locale, "favorite.empty", actionLabel(CodeFavoriteAdd, locale)))
+		return
+	}
 
-		favDocuments := []models.ArticleDocument{}
-		favs := userData.Favorites[startIdx:endIdx]
-		fmt.Println(favs)
+	favDocuments, lastPage, err := controllers.GetFavoriteArticles(meta.Collection, favorites, sortBy, currentPage, columnCount)
+	if err != nil {
+		meta.Log.Println("Unable to get favorite articles", err)
+		sendTextMessage(event, tr(locale, "error.query"))
+		return
+	}
 
-		for i := startIdx; i < endIdx; i++ {
-			favArticleId := userData.Favorites[i]
-			query := bson.M{"article_id": favArticleId}
-			tmpRecord, _ := controllers.GetOne(meta.Collection, query)
-			favDocuments = append(favDocuments, *tmpRecord)
-		}
+	fillMissingArticles(favDocuments, notes, locale)
 
-		// append next page column
-		previousPage := currentPage - 1
-		if previousPage < 0 {
-			previousPage = 0
-		}
-		nextPage := currentPage + 1
-		previousData := fmt.Sprintf("action=%s&page=%d&user_id=%s", ActonShowFav, previousPage, userId)
-		nextData := fmt.Sprintf("action=%s&page=%d&user_id=%s", ActonShowFav, nextPage, userId)
-		previousText := fmt.Sprintf("上一頁 %d", previousPage)
-		nextText := fmt.Sprintf("下一頁 %d", nextPage)
-		if lastPage == true {
-			nextData = "--"
-			nextText = "--"
-		}
+	carousel := newArticleCarousel(event, favDocuments)
+	carousel.notes = notes
+	nav := &Postback{Action: CodeShowFavorite, Collection: pb.Collection, Sort: sortBy}
+	carousel.nav = newPageNav(nav, currentPage, lastPage)
+	carousel.replies = getFavoriteSortButtons(nav, locale)
+	sendArticles(event, carousel, tr(locale, "alt.favorites"))
+}
 
-		tmpColumn := linebot.NewCarouselColumn(
-			defaultThumbnail,
-			DefaultTitle,
-			"繼續看？",
-			linebot.NewMessageTemplateAction(ActionHelp, ActionHelp),
-			linebot.NewPostbackTemplateAction(previousText, previousData, "", ""),
-			linebot.NewPostbackTemplateAction(nextText, nextData, "", ""),
-		)
+func actionHelp(event *linebot.Event, pb *Postback) {
+	locale := getLocale(event)
+	template := getMenuButtonTemplateV2(locale)
+	sendCarouselMessage(event, template, tr(locale, "menu.alt"))
+}
 
-		template := getCarouseTemplate(event.Source.UserID, favDocuments)
-		template.Columns = append(template.Columns, tmpColumn)
-		sendCarouselMessage(event, template, "最愛照片已送達")
+// withPeriod 產生查詢固定時間區間熱門文章的 handler
+func withPeriod(period int) func(event *linebot.Event, pb *Postback) {
+	return func(event *linebot.Event, pb *Postback) {
+		actionGeneral(event, &Postback{Action: CodeQuery, Period: period})
 	}
 }
 
-func actionGeneral(event *linebot.Event, action string, values url.Values) {
-	meta.Log.Println("Enter actionGeneral, action = ", action)
-	meta.Log.Println("Enter actionGeneral, values = ", values)
+func actionGeneral(event *linebot.Event, pb *Postback) {
+	meta.Log.Println("Enter actionGeneral, action = ", pb.Action)
+	meta.Log.Println("Enter actionGeneral, postback = ", pb)
 	records := []models.ArticleDocument{}
 	label := ""
-	switch action {
-	case ActionQuery:
-		//meta.Log.Println(values.Get("period"))
-		tsOffset, _ := strconv.Atoi(values.Get("period"))
+	settings := getSettings(event)
+	count := getPageSize(settings, maxCountOfCarousel)
+	switch pb.Action {
+	case CodeQuery:
+		tsOffset := pb.Period
 		meta.Log.Println("timestampe off set = ", tsOffset)
-		records, _ = controllers.GetMostLike(meta.Collection, maxCountOfCarousel, tsOffset)
-		label = "已幫您查詢到一些照片~"
-	case ActionRandom:
-		records, _ = controllers.GetRandom(meta.Collection, maxCountOfCarousel, "")
-		label = "隨機表特已送到囉"
+		records, _ = controllers.GetMostLike(meta.Collection, count, tsOffset, settings.Filter())
+		label = tr(getSettingsLocale(settings), "alt.query")
+	case CodeRandom:
+		records, _ = controllers.GetRandom(meta.Collection, count, "", settings.Filter())
+		label = tr(getSettingsLocale(settings), "alt.random")
 	default:
 		return
 	}
-	template := getCarouseTemplate(event.Source.UserID, records)
-	if template != nil {
-		sendCarouselMessage(event, template, label)
-	}
-
+	sortArticles(records, settings.Order)
+	carousel := newArticleCarousel(event, records)
+	sendArticles(event, carousel, label)
 }
 
-func actionAllImage(event *linebot.Event, values url.Values) {
-	if articleId := values.Get("article_id"); articleId != "" {
+func actionAllImage(event *linebot.Event, pb *Postback) {
+	if articleId := pb.ArticleID; articleId != "" {
 		query := bson.M{"article_id": articleId}
-		result, _ := controllers.GetOne(meta.Collection, query)
-		template := getImgCarousTemplate(result, values)
+		result, err := controllers.GetOne(meta.Collection, query)
+		if err != nil {
+			meta.Log.Println("Unable to get article", articleId, err)
+			sendTextMessage(event, tr(getLocale(event), "article.missing"))
+			return
+		}
+		template := getImgCarousTemplate(result, pb, getLocale(event))
 		sendImgCarouseMessage(event, template)
 	} else {
-		meta.Log.Println("Unable to get article id", values)
+		meta.Log.Println("Unable to get article id", pb)
 	}
 }
 
-func actionNewest(event *linebot.Event, values url.Values) {
-	columnCount := 9
-	if currentPage, err := strconv.Atoi(values.Get("page")); err != nil {
-		meta.Log.Println("Unable to parse parameters", values)
-	} else {
-		records, _ := controllers.Get(meta.Collection, currentPage, columnCount)
-		for idx, record := range records {
-			meta.Log.Printf("ID: %d, Date: %s, Title: %s", idx, record.Date, record.ArticleTitle)
-		}
-		template := getCarouseTemplate(event.Source.UserID, records)
-
-		if template == nil {
-			meta.Log.Println("Unable to get template", values)
-			return
-		}
-
-		// append next page column
-		previousPage := currentPage - 1
-		if previousPage < 0 {
-			previousPage = 0
-		}
-		nextPage := currentPage + 1
-		previousData := fmt.Sprintf("action=%s&page=%d", ActionNewest, previousPage)
-		nextData := fmt.Sprintf("action=%s&page=%d", ActionNewest, nextPage)
-		previousText := fmt.Sprintf("上一頁 %d", previousPage)
-		nextText := fmt.Sprintf("下一頁 %d", nextPage)
-		tmpColumn := linebot.NewCarouselColumn(
-			defaultThumbnail,
-			DefaultTitle,
-			"繼續看？",
-			linebot.NewMessageTemplateAction(ActionHelp, ActionHelp),
-			linebot.NewPostbackTemplateAction(previousText, previousData, "", ""),
-			linebot.NewPostbackTemplateAction(nextText, nextData, "", ""),
-		)
-		template.Columns = append(template.Columns, tmpColumn)
-
-		sendCarouselMessage(event, template, "熱騰騰的最新照片送到了!")
+func actionNewest(event *linebot.Event, pb *Postback) {
+	settings := getSettings(event)
+	columnCount := getPageSize(settings, 9)
+	currentPage := pb.Page
+	records, _ := controllers.Get(meta.Collection, currentPage, columnCount, settings.Filter())
+	sortArticles(records, settings.Order)
+	for idx, record := range records {
+		meta.Log.Printf("ID: %d, Date: %s, Title: %s", idx, record.Date, record.ArticleTitle)
 	}
+	if len(records) == 0 {
+		meta.Log.Println("Unable to get template", pb)
+		return
+	}
+
+	carousel := newArticleCarousel(event, records)
+	carousel.nav = newPageNav(&Postback{Action: CodeNewest}, currentPage, false)
+	sendArticles(event, carousel, tr(getSettingsLocale(settings), "alt.newest"))
 }
 
-func getCarouseTemplate(userId string, records []models.ArticleDocument) (template *linebot.CarouselTemplate) {
+func getCarouseTemplate(favorites map[string]bool, records []models.ArticleDocument, locale string) (template *linebot.CarouselTemplate) {
 	if len(records) == 0 {
 		return nil
 	}
 
 	columnList := []*linebot.CarouselColumn{}
-	userFavorite := &controllers.UserFavorite{
-		UserId:    userId,
-		Favorites: []string{},
-	}
-	userData, _ := userFavorite.Get(meta)
 	favLabel := ""
 
 	for _, result := range records {
-		if exist, _ := utils.InArray(result.ArticleID, userData.Favorites); exist == true {
-			favLabel = "❤️ 移除最愛"
+		if favorites[result.ArticleID] {
+			favLabel = actionLabel(CodeFavoriteRemove, locale)
 		} else {
-			favLabel = "💛 加入最愛"
+			favLabel = actionLabel(CodeFavoriteAdd, locale)
 		}
 		thumnailUrl := defaultImage
 		imgUrlCounts := len(result.ImageLinks)
-		lable := fmt.Sprintf("%s (%d)", ActionAllImage, imgUrlCounts)
 		title := result.ArticleTitle
-		postBackData := fmt.Sprintf("action=%s&article_id=%s&page=0", ActionAllImage, result.ArticleID)
 		text := fmt.Sprintf("%d 😍\t%d 😡", result.MessageCount.Push, result.MessageCount.Boo)
 
 		if imgUrlCounts > 0 {
@@ -348,9 +384,7 @@ func getCarouseTemplate(userId string, records []models.ArticleDocument) (templa
 		}
 
 		// Title's hard limit by Line
-		if len(title) >= 40 {
-			title = title[0:38]
-		}
+		title = utils.TruncateRunes(title, maxColumnTitleLength)
 		//meta.Log.Println("===============", idx)
 		//meta.Log.Println("Thumbnail Url = ", thumnailUrl)
 		//meta.Log.Println("Title = ", title)
@@ -358,16 +392,17 @@ func getCarouseTemplate(userId string, records []models.ArticleDocument) (templa
 		//meta.Log.Println("URL = ", result.URL)
 		//meta.Log.Println("===============", idx)
 		//dataRandom := fmt.Sprintf("action=%s", ActionRandom)
-		dataAddFavorite := fmt.Sprintf("action=%s&user_id=%s&article_id=%s",
-			ActionAddFavorite, userId, result.ArticleID)
+		dataAddFavorite := getFavoritePostback(result.ArticleID, favorites[result.ArticleID])
+		dataMore := postbackData(&Postback{Action: CodeMore, ArticleID: result.ArticleID})
+		// 每欄最多三個按鈕，預覽圖片放在「更多」裡
 		tmpColumn := linebot.NewCarouselColumn(
 			thumnailUrl,
 			title,
 			text,
-			linebot.NewURITemplateAction(ActionClick, result.URL),
-			linebot.NewPostbackTemplateAction(lable, postBackData, "", ""),
-			//linebot.NewPostbackTemplateAction(ActionRandom, dataRandom, "", ""),
-			linebot.NewPostbackTemplateAction(favLabel, dataAddFavorite, "", ""),
+			linebot.NewURIAction(tr(locale, "card.click"), result.URL),
+			//linebot.NewPostbackAction(ActionRandom, dataRandom, "", ""),
+			linebot.NewPostbackAction(favLabel, dataAddFavorite, "", ""),
+			linebot.NewPostbackAction(actionLabel(CodeMore, locale), dataMore, "", ""),
 		)
 		columnList = append(columnList, tmpColumn)
 	}
@@ -376,10 +411,16 @@ func getCarouseTemplate(userId string, records []models.ArticleDocument) (templa
 }
 
 func postbackHandler(event *linebot.Event) {
-	m, _ := url.ParseQuery(event.Postback.Data)
-	action := m.Get("action")
-	meta.Log.Println("Action = ", action)
-	actionHandler(event, action, m)
+	pb, err := DecodePostback(event.Postback.Data)
+	if err == ErrInvalidPostbackSignature {
+		meta.Log.Printf("Reject tampered postback from User (%s)\n", utils.RedactID(event.Source.UserID))
+		return
+	} else if err != nil {
+		meta.Log.Println("Unable to decode postback", err)
+		return
+	}
+	meta.Log.Println("Action = ", pb.Action)
+	actionHandler(event, pb)
 }
 
 func getUserNameById(userId string) (userDisplayName string) {
@@ -393,94 +434,33 @@ func getUserNameById(userId string) (userDisplayName string) {
 }
 
 func textHander(event *linebot.Event, message string) {
-	userFavorite := &controllers.UserFavorite{
-		UserId:    event.Source.UserID,
-		Favorites: []string{},
-	}
-	if _, err := userFavorite.Get(meta); err != nil {
-		meta.Log.Println("User data is not created, create a new one")
-		userFavorite.Add(meta)
-	}
-	switch message {
-	case ActionHelp:
-		template := getMenuButtonTemplateV2(event, DefaultTitle)
-		sendCarouselMessage(event, template, "我能為您做什麼？")
-	case ActionRandom:
-		records, _ := controllers.GetRandom(meta.Collection, maxCountOfCarousel, "")
-		template := getCarouseTemplate(event.Source.UserID, records)
-		sendCarouselMessage(event, template, "隨機表特已送到囉")
-	case ActionNewest:
-		values := url.Values{}
-		values.Set("period", fmt.Sprintf("%d", oneDayInSec))
-		values.Set("page", "0")
-		actionNewest(event, values)
-	case ActonShowFav:
-		values := url.Values{}
-		values.Set("user_id", event.Source.UserID)
-		values.Set("page", "0")
-		actionShowFavorite(event, "", values)
-	default:
-		if strings.HasPrefix(message, ActonRunCC) {
-			commands := strings.Split(message, " ")
-			action := commands[1]
-			cmd := exec.Command("./run_cc.sh", action)
-			stdout, err := cmd.StdoutPipe()
-			if err != nil {
-				log.Fatal(err)
-			}
-			defer stdout.Close()
-			if err := cmd.Start(); err != nil {
-				log.Fatal(err)
-			}
-			// 读取输出结果
-			opBytes, err := ioutil.ReadAll(stdout)
-			if err != nil {
-				log.Fatal(err)
-			}
-			log.Println(string(opBytes))
-			sendTextMessage(event, string(opBytes))
+	// 群組裡只回應有前綴的訊息，管理指令只能在一對一聊天使用
+	if getGroupId(event.Source) != "" {
+		var ok bool
+		if message, ok = groupTextHandler(event, message); !ok {
 			return
 		}
-
-		if event.Source.UserID != "" && event.Source.GroupID == "" && event.Source.RoomID == "" {
-			records, _ := controllers.GetRandom(meta.Collection, maxCountOfCarousel, message)
-			if records != nil && len(records) > 0 {
-				template := getCarouseTemplate(event.Source.UserID, records)
-				sendCarouselMessage(event, template, "隨機表特已送到囉")
-			} else {
-				template := getMenuButtonTemplateV2(event, DefaultTitle)
-				sendCarouselMessage(event, template, "我能為您做什麼？")
-			}
-		}
+	} else if strings.HasPrefix(message, ActionAdmin) {
+		runAdminCommand(event, message)
+		return
+	}
+	if dispatchText(event, message) || subscriptionTextHandler(event, message) || collectionTextHandler(event, message) ||
+		favoriteTextHandler(event, message) || shareTextHandler(event, message) ||
+		exportTextHandler(event, message) || privacyTextHandler(event, message) {
+		return
 	}
-}
 
-func getMenuButtonTemplateV2(event *linebot.Event, title string) (template *linebot.CarouselTemplate) {
-	columnList := []*linebot.CarouselColumn{}
-	dataNewlest := fmt.Sprintf("action=%s&page=0", ActionNewest)
-	dataRandom := fmt.Sprintf("action=%s", ActionRandom)
-	dataQuery := fmt.Sprintf("action=%s", ActionQuery)
-	dataShowFav := fmt.Sprintf("action=%s&user_id=%s&page=0", ActonShowFav, event.Source.UserID)
-
-	menu1 := linebot.NewCarouselColumn(
-		defaultThumbnail,
-		title,
-		"你可以試試看以下選項，或直接輸入關鍵字查詢",
-		linebot.NewPostbackTemplateAction(ActionNewest, dataNewlest, "", ""),
-		linebot.NewPostbackTemplateAction(ActionRandom, dataRandom, "", ""),
-		linebot.NewPostbackTemplateAction(ActonShowFav, dataShowFav, "", ""),
-	)
-	menu2 := linebot.NewCarouselColumn(
-		defaultThumbnail,
-		title,
-		"你可以試試看以下選項，或直接輸入關鍵字查詢",
-		linebot.NewPostbackTemplateAction(ActionDailyHot, dataQuery+"&period="+fmt.Sprintf("%d", oneDayInSec), "", ""),
-		linebot.NewPostbackTemplateAction(ActionMonthlyHot, dataQuery+"&period="+fmt.Sprintf("%d", oneWeekInSec), "", ""),
-		linebot.NewPostbackTemplateAction(ActionYearHot, dataQuery+"&period="+fmt.Sprintf("%d", oneYearInSec), "", ""),
-	)
-	columnList = append(columnList, menu1, menu2)
-	template = linebot.NewCarouselTemplate(columnList...)
-	return template
+	settings := getSettings(event)
+	records, _ := controllers.GetRandom(meta.Collection, getPageSize(settings, maxCountOfCarousel), message, settings.Filter())
+	sortArticles(records, settings.Order)
+	if records != nil && len(records) > 0 {
+		carousel := newArticleCarousel(event, records)
+		sendArticles(event, carousel, tr(carousel.locale, "alt.random"))
+	} else {
+		locale := getSettingsLocale(settings)
+		template := getMenuButtonTemplateV2(locale)
+		sendCarouselMessage(event, template, tr(locale, "menu.alt"))
+	}
 }
 
 //func getMenuButtonTemplate(event *linebot.Event, title string) (template *linebot.ButtonsTemplate) {
@@ -489,27 +469,28 @@ func getMenuButtonTemplateV2(event *linebot.Event, title string) (template *line
 //	dataQuery := fmt.Sprintf("action=%s", ActionQuery)
 //	dataShowFav := fmt.Sprintf("action=%s&user_id=%s", ActonShowFav, event.Source.UserID)
 //	template = linebot.NewButtonsTemplate(defaultThumbnail, title, "你可以試試看以下選項，或直接輸入關鍵字查詢",
-//		linebot.NewPostbackTemplateAction(ActionNewest, dataNewlest, "", ""),
-//		linebot.NewPostbackTemplateAction(ActionDailyHot, dataQuery+"&period="+fmt.Sprintf("%d", oneDayInSec), "", ""),
-//		linebot.NewPostbackTemplateAction(ActonShowFav, dataShowFav, "", ""),
-//		//linebot.NewPostbackTemplateAction(ActionMonthlyHot, dataQuery+"&period="+fmt.Sprintf("%d", oneMonthInSec), "", ""),
-//		//linebot.NewPostbackTemplateAction(ActionYearHot, dataQuery + "&period="+fmt.Sprintf("%d", oneYearInSec), "", ""),
-//		linebot.NewPostbackTemplateAction(ActionRandom, dataRandom, "", ""),
+//		linebot.NewPostbackAction(ActionNewest, dataNewlest, "", ""),
+//		linebot.NewPostbackAction(ActionDailyHot, dataQuery+"&period="+fmt.Sprintf("%d", oneDayInSec), "", ""),
+//		linebot.NewPostbackAction(ActonShowFav, dataShowFav, "", ""),
+//		//linebot.NewPostbackAction(ActionMonthlyHot, dataQuery+"&period="+fmt.Sprintf("%d", oneMonthInSec), "", ""),
+//		//linebot.NewPostbackAction(ActionYearHot, dataQuery + "&period="+fmt.Sprintf("%d", oneYearInSec), "", ""),
+//		linebot.NewPostbackAction(ActionRandom, dataRandom, "", ""),
 //	)
 //	return template
 //}
 
 func sendTextMessage(event *linebot.Event, text string) {
-	if _, err := bot.ReplyMessage(event.ReplyToken, linebot.NewTextMessage(text)).Do(); err != nil {
+	message := linebot.NewTextMessage(text).WithQuickReplies(getQuickReplyItems(event, nil))
+	if err := replyMessage(event, message); err != nil {
 		log.Println("Send Fail")
 	}
 }
 
-func getImgCarousTemplate(record *models.ArticleDocument, values url.Values) (template *linebot.ImageCarouselTemplate) {
+func getImgCarousTemplate(record *models.ArticleDocument, pb *Postback, locale string) (template *linebot.ImageCarouselTemplate) {
 	urls := record.ImageLinks
 	columnList := []*linebot.ImageCarouselColumn{}
-	articleID := values.Get("article_id")
-	page, _ := strconv.Atoi(values.Get("page"))
+	articleID := pb.ArticleID
+	page := pb.Page
 	startIdx := page * 9
 	endIdx := startIdx + 9
 	lastPage := false
@@ -524,15 +505,15 @@ func getImgCarousTemplate(record *models.ArticleDocument, values url.Values) (te
 	for _, url := range urls {
 		tmpColumn := linebot.NewImageCarouselColumn(
 			url,
-			linebot.NewURITemplateAction(ActionClick, url),
+			linebot.NewURIAction(tr(locale, "card.click"), url),
 		)
 		columnList = append(columnList, tmpColumn)
 	}
 	if lastPage == false {
-		postBackData := fmt.Sprintf("action=%s&article_id=%s&page=%d", ActionAllImage, articleID, page+1)
+		postBackData := postbackData(&Postback{Action: CodeAllImage, ArticleID: articleID, Page: page + 1})
 		tmpColumn := linebot.NewImageCarouselColumn(
 			defaultImage,
-			linebot.NewPostbackTemplateAction("下一頁", postBackData, "", ""),
+			linebot.NewPostbackAction(tr(locale, "nav.next_image"), postBackData, "", ""),
 		)
 		columnList = append(columnList, tmpColumn)
 	}
@@ -542,9 +523,8 @@ func getImgCarousTemplate(record *models.ArticleDocument, values url.Values) (te
 }
 
 func sendCarouselMessage(event *linebot.Event, template *linebot.CarouselTemplate, altText string) {
-	if _, err := bot.ReplyMessage(event.ReplyToken, linebot.NewTemplateMessage(altText, template)).Do(); err != nil {
-		meta.Log.Println(err)
-	}
+	message := linebot.NewTemplateMessage(altText, template).WithQuickReplies(getQuickReplyItems(event, nil))
+	replyMessage(event, message)
 }
 
 //func sendButtonMessage(event *linebot.Event, template *linebot.ButtonsTemplate) {
@@ -554,7 +534,6 @@ func sendCarouselMessage(event *linebot.Event, template *linebot.CarouselTemplat
 //}
 
 func sendImgCarouseMessage(event *linebot.Event, template *linebot.ImageCarouselTemplate) {
-	if _, err := bot.ReplyMessage(event.ReplyToken, linebot.NewTemplateMessage("預覽圖片已送達", template)).Do(); err != nil {
-		meta.Log.Println(err)
-	}
+	message := linebot.NewTemplateMessage(tr(getLocale(event), "alt.preview"), template).WithQuickReplies(getQuickReplyItems(event, nil))
+	replyMessage(event, message)
 }
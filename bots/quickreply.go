@@ -0,0 +1,28 @@
+package bots
+
+import (
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+func getSearchTips(locale string) string {
+	return tr(locale, "search_tips", actionLabel(CodeHelp, locale))
+}
+
+// getQuickReplyItems 依照目前的動作產生常用的下一步，有下一頁時放在第一個
+func getQuickReplyItems(event *linebot.Event, nav *pageNav) *linebot.QuickReplyItems {
+	locale := getLocale(event)
+	buttons := []*linebot.QuickReplyButton{}
+	if nav != nil && nav.nextData != "" {
+		nextText := nav.nextText(locale)
+		buttons = append(buttons, linebot.NewQuickReplyButton("",
+			linebot.NewPostbackAction(nextText, nav.nextData, "", nextText)))
+	}
+	for _, code := range []ActionCode{CodeRandom, CodeDailyHot, CodeShowFavorite} {
+		label := actionLabel(code, locale)
+		data := postbackData(&Postback{Action: code})
+		buttons = append(buttons, linebot.NewQuickReplyButton("", linebot.NewPostbackAction(label, data, "", label)))
+	}
+	searchTipsLabel := actionLabel(CodeSearchTips, locale)
+	buttons = append(buttons, linebot.NewQuickReplyButton("", linebot.NewMessageAction(searchTipsLabel, searchTipsLabel)))
+	return newQuickReplyItems(buttons...)
+}
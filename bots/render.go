@@ -0,0 +1,191 @@
+package bots
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/mong0520/linebot-ptt-beauty/controllers"
+	"github.com/mong0520/linebot-ptt-beauty/models"
+)
+
+// 文章卡片的呈現方式，由環境變數 ArticleRenderer 設定
+const (
+	RendererTemplate string = "template"
+	RendererFlex     string = "flex"
+)
+
+var articleRenderer = RendererTemplate
+var rendererLock sync.RWMutex
+
+// setArticleRenderer 依環境變數 ArticleRenderer 設定，不認得的值使用 template
+func setArticleRenderer(renderer string) {
+	rendererLock.Lock()
+	defer rendererLock.Unlock()
+	articleRenderer = RendererTemplate
+	if strings.ToLower(renderer) == RendererFlex {
+		articleRenderer = RendererFlex
+	}
+}
+
+func getArticleRenderer() string {
+	rendererLock.RLock()
+	defer rendererLock.RUnlock()
+	return articleRenderer
+}
+
+// pageNav 是附在文章卡片最後的換頁選項，nextData 為空代表已是最後一頁
+type pageNav struct {
+	previousPage int
+	previousData string
+	nextPage     int
+	nextData     string
+}
+
+func (n *pageNav) previousText(locale string) string {
+	return tr(locale, "nav.previous", n.previousPage)
+}
+
+func (n *pageNav) nextText(locale string) string {
+	if n.nextData == "" {
+		return "--"
+	}
+	return tr(locale, "nav.next", n.nextPage)
+}
+
+// articleCarousel 描述一組要送給使用者的文章卡片，groupId 不為空時顯示群組最愛
+type articleCarousel struct {
+	userId  string
+	groupId string
+	records []models.ArticleDocument
+	// locale 是按鈕與說明文字的語言
+	locale string
+	// notes 以 article_id 對應，附加在卡片文字後面
+	notes map[string]string
+	nav   *pageNav
+	// replies 放在預設快速回覆前面
+	replies []*linebot.QuickReplyButton
+}
+
+func newArticleCarousel(event *linebot.Event, records []models.ArticleDocument) *articleCarousel {
+	return &articleCarousel{
+		userId:  event.Source.UserID,
+		groupId: getGroupId(event.Source),
+		records: records,
+		locale:  getLocale(event),
+	}
+}
+
+func (c *articleCarousel) favoriteSet() map[string]bool {
+	if c.groupId != "" {
+		return getGroupFavoriteSet(c.groupId)
+	}
+	return getFavoriteSet(c.userId)
+}
+
+// newPageNav 以 pb 為範本產生上一頁、下一頁的 postback
+func newPageNav(pb *Postback, currentPage int, lastPage bool) *pageNav {
+	previousPage := currentPage - 1
+	if previousPage < 0 {
+		previousPage = 0
+	}
+	nextPage := currentPage + 1
+	previous := *pb
+	previous.Page = previousPage
+	next := *pb
+	next.Page = nextPage
+	nav := &pageNav{
+		previousPage: previousPage,
+		previousData: postbackData(&previous),
+		nextPage:     nextPage,
+		nextData:     postbackData(&next),
+	}
+	if lastPage {
+		nav.nextData = ""
+	}
+	return nav
+}
+
+// renderArticles 依設定產生 Flex 或 Template 訊息，沒有文章時回傳 nil
+func renderArticles(carousel *articleCarousel, altText string) linebot.SendingMessage {
+	if len(carousel.records) == 0 {
+		return nil
+	}
+	if getArticleRenderer() == RendererFlex {
+		return linebot.NewFlexMessage(altText, getFlexCarousel(carousel))
+	}
+
+	locale := carousel.locale
+	template := getCarouseTemplate(carousel.favoriteSet(), carousel.records, locale)
+	for idx, column := range template.Columns {
+		if note, ok := carousel.notes[carousel.records[idx].ArticleID]; ok {
+			column.Text = fmt.Sprintf("%s\t%s", column.Text, note)
+		}
+	}
+	if nav := carousel.nav; nav != nil {
+		nextData := nav.nextData
+		if nextData == "" {
+			nextData = "--"
+		}
+		helpLabel := actionLabel(CodeHelp, locale)
+		tmpColumn := linebot.NewCarouselColumn(
+			defaultThumbnail,
+			tr(locale, "title"),
+			tr(locale, "nav.more"),
+			linebot.NewMessageAction(helpLabel, helpLabel),
+			linebot.NewPostbackAction(nav.previousText(locale), nav.previousData, "", ""),
+			linebot.NewPostbackAction(nav.nextText(locale), nextData, "", ""),
+		)
+		template.Columns = append(template.Columns, tmpColumn)
+	}
+	return linebot.NewTemplateMessage(altText, template)
+}
+
+func sendArticles(event *linebot.Event, carousel *articleCarousel, altText string) {
+	message := renderArticles(carousel, altText)
+	if message == nil {
+		meta.Log.Println("No articles to send")
+		return
+	}
+	items := getQuickReplyItems(event, carousel.nav)
+	if len(carousel.replies) > 0 {
+		items = newQuickReplyItems(append(carousel.replies, items.Items...)...)
+	}
+	message = message.WithQuickReplies(items)
+	replyMessage(event, message)
+}
+
+// getFavoriteSet 取出使用者的最愛，找不到使用者時回傳空集合
+func getFavoriteSet(userId string) map[string]bool {
+	favorites := map[string]bool{}
+	userFavorite := &controllers.UserFavorite{
+		UserId:    userId,
+		Favorites: []controllers.FavoriteItem{},
+	}
+	if userData, err := userFavorite.GetOrEmpty(meta); err == nil {
+		for _, articleId := range userData.FavoriteIds() {
+			favorites[articleId] = true
+		}
+	}
+	return favorites
+}
+
+func getGroupFavoriteSet(groupId string) map[string]bool {
+	favorites := map[string]bool{}
+	group := &controllers.Group{GroupId: groupId}
+	if groupData, err := group.Get(meta); err == nil {
+		for _, articleId := range groupData.FavoriteIds() {
+			favorites[articleId] = true
+		}
+	}
+	return favorites
+}
+
+// getFavoritePostback 依目前狀態產生加入或移除最愛的 postback，不使用切換
+func getFavoritePostback(articleId string, isFavorite bool) string {
+	if isFavorite {
+		return postbackData(&Postback{Action: CodeFavoriteRemove, ArticleID: articleId})
+	}
+	return postbackData(&Postback{Action: CodeFavoriteAdd, ArticleID: articleId})
+}
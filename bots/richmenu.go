@@ -0,0 +1,166 @@
+package bots
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/mong0520/linebot-ptt-beauty/models"
+)
+
+type RichMenuBounds struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+type RichMenuArea struct {
+	Bounds RichMenuBounds `json:"bounds"`
+	// Action 是 richMenuActions 裡的名稱，例如 newest、random
+	Action string `json:"action"`
+}
+
+type RichMenuConfig struct {
+	Name        string         `json:"name"`
+	ChatBarText string         `json:"chat_bar_text"`
+	Width       int            `json:"width"`
+	Height      int            `json:"height"`
+	Selected    bool           `json:"selected"`
+	Image       string         `json:"image"`
+	Areas       []RichMenuArea `json:"areas"`
+}
+
+// richMenuActions 對應到既有的 postback 動作，rich menu 是共用的所以不帶 user_id
+var richMenuActions = map[string]*Postback{
+	"newest":      {Action: CodeNewest},
+	"random":      {Action: CodeRandom},
+	"daily_hot":   {Action: CodeDailyHot},
+	"monthly_hot": {Action: CodeMonthlyHot},
+	"year_hot":    {Action: CodeYearHot},
+	"favorites":   {Action: CodeShowFavorite},
+	"on_this_day": {Action: CodeOnThisDay},
+	"top_author":  {Action: CodeTopAuthor},
+}
+
+// newLineClient 建立 Line client，設定 LineAPIEndpoint 時改連到該位址 (例如本機測試用的假伺服器)
+func newLineClient() (*linebot.Client, error) {
+	secret := os.Getenv("ChannelSecret")
+	token := os.Getenv("ChannelAccessToken")
+	return linebot.New(secret, token, getEndpointOptions(os.Getenv("LineAPIEndpoint"))...)
+}
+
+// getEndpointOptions 上傳圖片與下載檔案走另一個網域，假伺服器要兩個都接
+func getEndpointOptions(endpoint string) []linebot.ClientOption {
+	if endpoint == "" {
+		return nil
+	}
+	return []linebot.ClientOption{linebot.WithEndpointBase(endpoint), linebot.WithEndpointBaseData(endpoint)}
+}
+
+func LoadRichMenuConfig(path string) (config *RichMenuConfig, err error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config = &RichMenuConfig{}
+	if err := json.Unmarshal(b, config); err != nil {
+		return nil, fmt.Errorf("invalid rich menu config %s: %v", path, err)
+	}
+	return config, nil
+}
+
+func (c *RichMenuConfig) toRichMenu() (richMenu linebot.RichMenu, err error) {
+	areas := []linebot.AreaDetail{}
+	for _, area := range c.Areas {
+		postback, ok := richMenuActions[area.Action]
+		if !ok {
+			return richMenu, fmt.Errorf("unknown rich menu action %q", area.Action)
+		}
+		data, err := postback.Encode()
+		if err != nil {
+			return richMenu, err
+		}
+		areas = append(areas, linebot.AreaDetail{
+			Bounds: linebot.RichMenuBounds{
+				X:      area.Bounds.X,
+				Y:      area.Bounds.Y,
+				Width:  area.Bounds.Width,
+				Height: area.Bounds.Height,
+			},
+			Action: linebot.RichMenuAction{
+				Type: linebot.RichMenuActionTypePostback,
+				Data: data,
+			},
+		})
+	}
+	richMenu = linebot.RichMenu{
+		Size:        linebot.RichMenuSize{Width: c.Width, Height: c.Height},
+		Selected:    c.Selected,
+		Name:        c.Name,
+		ChatBarText: c.ChatBarText,
+		Areas:       areas,
+	}
+	return richMenu, nil
+}
+
+// ProvisionRichMenu 建立 rich menu、上傳圖片並設為預設，成功後才刪掉同名的舊選單，
+// 中途失敗時使用者還是看得到原本的選單
+func ProvisionRichMenu(client *linebot.Client, config *RichMenuConfig) (richMenuID string, err error) {
+	richMenu, err := config.toRichMenu()
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(config.Image); err != nil {
+		return "", fmt.Errorf("rich menu image: %v", err)
+	}
+
+	existing, err := client.GetRichMenuList().Do()
+	if err != nil {
+		return "", fmt.Errorf("list rich menu: %v", err)
+	}
+
+	res, err := client.CreateRichMenu(richMenu).Do()
+	if err != nil {
+		return "", fmt.Errorf("create rich menu: %v", err)
+	}
+	richMenuID = res.RichMenuID
+	if _, err := client.UploadRichMenuImage(richMenuID, config.Image).Do(); err != nil {
+		return richMenuID, fmt.Errorf("upload rich menu image: %v", err)
+	}
+	if _, err := client.SetDefaultRichMenu(richMenuID).Do(); err != nil {
+		return richMenuID, fmt.Errorf("set default rich menu: %v", err)
+	}
+
+	for _, old := range existing {
+		if old.Name == config.Name {
+			if _, err := client.DeleteRichMenu(old.RichMenuID).Do(); err != nil {
+				return richMenuID, fmt.Errorf("delete rich menu %s: %v", old.RichMenuID, err)
+			}
+		}
+	}
+	return richMenuID, nil
+}
+
+// SetupRichMenu 讀取設定檔並建立預設 rich menu，給 main 的 -richmenu 參數使用
+func SetupRichMenu(m *models.Model, path string) (err error) {
+	config, err := LoadRichMenuConfig(path)
+	if err != nil {
+		return err
+	}
+	client, err := newLineClient()
+	if err != nil {
+		return err
+	}
+	if err := initPostbackSecret(); err != nil {
+		return err
+	}
+	richMenuID, err := ProvisionRichMenu(client, config)
+	if err != nil {
+		return err
+	}
+	m.Log.Printf("Rich menu %s (%s) is set as default\n", config.Name, richMenuID)
+	return nil
+}
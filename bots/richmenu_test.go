@@ -0,0 +1,149 @@
+package bots
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+// fakeLineServer 是 Line API 的本機替身，記錄收到的請求，failPath 符合時回傳 500
+type fakeLineServer struct {
+	lock      sync.Mutex
+	calls     []string
+	created   linebot.RichMenu
+	imageType string
+	failPath  string
+}
+
+func (f *fakeLineServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	call := r.Method + " " + r.URL.Path
+	f.calls = append(f.calls, call)
+	if call == f.failPath {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, `{"message":"fail"}`)
+		return
+	}
+	switch {
+	case call == "GET /v2/bot/richmenu/list":
+		fmt.Fprint(w, `{"richmenus":[{"richMenuId":"old-menu","name":"表特選單"},{"richMenuId":"other-menu","name":"其他選單"}]}`)
+	case call == "POST /v2/bot/richmenu":
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &f.created)
+		fmt.Fprint(w, `{"richMenuId":"new-menu"}`)
+	case strings.HasSuffix(call, "/content"):
+		f.imageType = r.Header.Get("Content-Type")
+		fmt.Fprint(w, `{}`)
+	default:
+		fmt.Fprint(w, `{}`)
+	}
+}
+
+func loadTestRichMenuConfig(t *testing.T) *RichMenuConfig {
+	config, err := LoadRichMenuConfig("../resource/richmenu.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Image = "../" + config.Image
+	return config
+}
+
+func TestProvisionRichMenu(t *testing.T) {
+	postbackSecret = []byte("test-secret")
+	fullSequence := []string{
+		"GET /v2/bot/richmenu/list",
+		"POST /v2/bot/richmenu",
+		"POST /v2/bot/richmenu/new-menu/content",
+		"POST /v2/bot/user/all/richmenu/new-menu",
+		"DELETE /v2/bot/richmenu/old-menu",
+	}
+	tests := []struct {
+		name      string
+		failPath  string
+		wantCalls []string
+		wantErr   string
+	}{
+		{"create, upload, set default and delete the old menu", "", fullSequence, ""},
+		{"keep the old menu when create fails", "POST /v2/bot/richmenu", fullSequence[:2], "create rich menu"},
+		{"keep the old menu when upload fails", "POST /v2/bot/richmenu/new-menu/content", fullSequence[:3], "upload rich menu image"},
+		{"keep the old menu when set default fails", "POST /v2/bot/user/all/richmenu/new-menu", fullSequence[:4], "set default rich menu"},
+		{"report delete failure", "DELETE /v2/bot/richmenu/old-menu", fullSequence, "delete rich menu old-menu"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeLineServer{failPath: tt.failPath}
+			server := httptest.NewServer(fake)
+			defer server.Close()
+			client, err := linebot.New("secret", "token", getEndpointOptions(server.URL)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = ProvisionRichMenu(client, loadTestRichMenuConfig(t))
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(fake.calls, tt.wantCalls) {
+				t.Errorf("calls = %q, want %q", fake.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestProvisionRichMenuContent(t *testing.T) {
+	postbackSecret = []byte("test-secret")
+	fake := &fakeLineServer{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	client, err := linebot.New("secret", "token", getEndpointOptions(server.URL)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := loadTestRichMenuConfig(t)
+	if _, err := ProvisionRichMenu(client, config); err != nil {
+		t.Fatal(err)
+	}
+
+	if fake.imageType != "image/png" {
+		t.Errorf("image content type = %q, want image/png", fake.imageType)
+	}
+	if fake.created.Name != config.Name || len(fake.created.Areas) != len(config.Areas) {
+		t.Fatalf("created rich menu = %+v", fake.created)
+	}
+	for idx, area := range fake.created.Areas {
+		pb, err := DecodePostback(area.Action.Data)
+		if err != nil {
+			t.Fatalf("area %d: %v", idx, err)
+		}
+		if want := richMenuActions[config.Areas[idx].Action].Action; pb.Action != want {
+			t.Errorf("area %d action = %q, want %q", idx, pb.Action, want)
+		}
+	}
+}
+
+func TestProvisionRichMenuMissingImage(t *testing.T) {
+	fake := &fakeLineServer{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	client, _ := linebot.New("secret", "token", getEndpointOptions(server.URL)...)
+	config := loadTestRichMenuConfig(t)
+	config.Image = "missing.png"
+	if _, err := ProvisionRichMenu(client, config); err == nil {
+		t.Fatal("expected error for missing image")
+	}
+	if len(fake.calls) != 0 {
+		t.Errorf("no request should be sent, got %q", fake.calls)
+	}
+}
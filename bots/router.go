@@ -0,0 +1,116 @@
+package bots
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+// Route 描述一個動作：postback 代碼、可以觸發它的文字、處理函式以及選單上的說明
+type Route struct {
+	Code  ActionCode
+	Label string
+	// Triggers 是使用者直接輸入就會觸發的文字
+	Triggers []string
+	// LegacyLabels 是舊版 postback 曾經用過的 action label，只有原本就有的按鈕才設定，
+	// 這些 label 不需要簽章就能觸發
+	LegacyLabels []string
+	Help         string
+	// MenuOrder 大於 0 時依序放進表特選單
+	MenuOrder int
+	Handler   func(event *linebot.Event, pb *Postback)
+}
+
+// 每個選單欄位最多三個按鈕
+var menuActionsPerColumn = 3
+
+var routes = []*Route{}
+var routesByCode = map[ActionCode]*Route{}
+var routesByTrigger = map[string]*Route{}
+
+// registerRoute 在各功能檔案的 init 呼叫，代碼或觸發文字重複時直接 panic
+func registerRoute(r *Route) {
+	if _, ok := routesByCode[r.Code]; ok {
+		panic(fmt.Sprintf("duplicate action code %q", r.Code))
+	}
+	routes = append(routes, r)
+	routesByCode[r.Code] = r
+	knownActions[r.Code] = true
+	// 有觸發文字的動作，其他語言的按鈕名稱也能觸發
+	triggers := r.Triggers
+	if len(triggers) > 0 {
+		triggers = append(triggers, localizedTriggers(r)...)
+	}
+	for _, trigger := range triggers {
+		if _, ok := routesByTrigger[trigger]; ok {
+			panic(fmt.Sprintf("duplicate action trigger %q", trigger))
+		}
+		routesByTrigger[trigger] = r
+	}
+	for _, label := range r.LegacyLabels {
+		legacyActions[label] = r.Code
+	}
+}
+
+func actionHandler(event *linebot.Event, pb *Postback) {
+	route, ok := routesByCode[pb.Action]
+	if !ok {
+		meta.Log.Println("Unimplement action handler", pb.Action)
+		return
+	}
+	route.Handler(event, pb)
+}
+
+// dispatchText 文字符合某個動作的觸發文字時執行它，回傳是否有處理
+func dispatchText(event *linebot.Event, message string) bool {
+	route, ok := routesByTrigger[strings.TrimSpace(message)]
+	if !ok {
+		return false
+	}
+	route.Handler(event, &Postback{Action: route.Code})
+	return true
+}
+
+func getMenuRoutes() []*Route {
+	menuRoutes := []*Route{}
+	for _, r := range routes {
+		if r.MenuOrder > 0 {
+			menuRoutes = append(menuRoutes, r)
+		}
+	}
+	sort.SliceStable(menuRoutes, func(i, j int) bool {
+		return menuRoutes[i].MenuOrder < menuRoutes[j].MenuOrder
+	})
+	return menuRoutes
+}
+
+// getMenuButtonTemplateV2 由註冊的動作產生表特選單，每欄三個按鈕，按鈕與說明文字依語言翻譯
+func getMenuButtonTemplateV2(locale string) (template *linebot.CarouselTemplate) {
+	title := tr(locale, "title")
+	searchTipsLabel := actionLabel(CodeSearchTips, locale)
+	columnList := []*linebot.CarouselColumn{}
+	menuRoutes := getMenuRoutes()
+	for start := 0; start < len(menuRoutes); start += menuActionsPerColumn {
+		end := start + menuActionsPerColumn
+		if end > len(menuRoutes) {
+			end = len(menuRoutes)
+		}
+		actions := []linebot.TemplateAction{}
+		helps := []string{}
+		for _, r := range menuRoutes[start:end] {
+			data := postbackData(&Postback{Action: r.Code})
+			actions = append(actions, linebot.NewPostbackAction(routeLabel(r, locale), data, "", ""))
+			helps = append(helps, routeHelp(r, locale))
+		}
+		// carousel 每欄的按鈕數量必須一樣，不足的補上搜尋教學
+		for len(actions) < menuActionsPerColumn {
+			actions = append(actions, linebot.NewMessageAction(searchTipsLabel, searchTipsLabel))
+		}
+		column := linebot.NewCarouselColumn(defaultThumbnail, title, strings.Join(helps, tr(locale, "list.separator")), actions...)
+		columnList = append(columnList, column)
+	}
+	template = linebot.NewCarouselTemplate(columnList...)
+	return template
+}
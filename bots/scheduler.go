@@ -0,0 +1,53 @@
+package bots
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mong0520/linebot-ptt-beauty/utils"
+)
+
+// parseClock 解析 "HH:MM" 格式的時間
+func parseClock(clock string) (hour int, minute int, err error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid clock %q: %v", clock, err)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// nextDailyRun 回傳下一次在台灣時間 hour:minute 執行的時間點
+func nextDailyRun(now time.Time, hour int, minute int) time.Time {
+	now = now.In(utils.GetTaipeiLocation())
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// runDaily 每天在台灣時間 hour:minute 執行一次 job
+func runDaily(name string, hour int, minute int, job func()) {
+	go func() {
+		for {
+			next := nextDailyRun(time.Now(), hour, minute)
+			meta.Log.Printf("Next %s job at %s\n", name, next)
+			time.Sleep(time.Until(next))
+			meta.Log.Printf("Start %s job\n", name)
+			job()
+			meta.Log.Printf("...%s job done\n", name)
+		}
+	}()
+}
+
+// runEvery 啟動時先執行一次 job，之後每隔 interval 再執行
+func runEvery(name string, interval time.Duration, job func()) {
+	go func() {
+		for {
+			meta.Log.Printf("Start %s job\n", name)
+			job()
+			meta.Log.Printf("...%s job done, next in %s\n", name, interval)
+			time.Sleep(interval)
+		}
+	}()
+}
@@ -0,0 +1,265 @@
+package bots
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/mong0520/linebot-ptt-beauty/controllers"
+	"github.com/mong0520/linebot-ptt-beauty/models"
+)
+
+const (
+	CodeSettings      ActionCode = "sg"
+	CodeSettingOption ActionCode = "so"
+	CodeSetSetting    ActionCode = "se"
+)
+
+func init() {
+	registerRoute(&Route{Code: CodeSettings, Label: ActionSettings, Triggers: []string{ActionSettings},
+		Help: "個人設定", MenuOrder: 150, Handler: actionSettings})
+	registerRoute(&Route{Code: CodeSettingOption, Label: "設定選項", Help: "設定選項", Handler: actionSettingOption})
+	registerRoute(&Route{Code: CodeSetSetting, Label: "修改設定", Help: "修改設定", Handler: actionSetSetting})
+}
+
+type settingOption struct {
+	label string
+	// value 是 postback 裡的值，空字串代表預設值
+	value string
+}
+
+// settingDefinitions 是設定選單的項目與可選的值，顯示順序即選單順序。
+// label 是繁體中文的名稱，其他語言在訊息目錄的 "setting.<欄位>" 與 "setting.<欄位>.<值>"
+var settingDefinitions = []struct {
+	field   string
+	label   string
+	options []settingOption
+}{
+	{controllers.SettingCategories, "分類", []settingOption{
+		{"正妹 (預設)", ""}, {"帥哥", "帥哥"}, {"正妹+帥哥", "正妹,帥哥"}, {"神人", "神人"}, {"正妹+神人", "正妹,神人"},
+	}},
+	{controllers.SettingPageSize, "每次筆數", []settingOption{
+		{"預設", ""}, {"3 篇", "3"}, {"5 篇", "5"}, {"9 篇", "9"},
+	}},
+	{controllers.SettingOrder, "排序", []settingOption{
+		{"預設", controllers.OrderDefault}, {"依推文數", controllers.OrderPush}, {"依文章日期", controllers.OrderDate},
+	}},
+	{controllers.SettingNoDigest, "熱門摘要", []settingOption{
+		{"開啟", ""}, {"暫停", "on"},
+	}},
+	{controllers.SettingLanguage, "語言", []settingOption{
+		{"繁體中文", ""}, {"English", controllers.LanguageEn}, {"日本語", controllers.LanguageJa},
+	}},
+	{controllers.SettingSafeMode, "安全模式", []settingOption{
+		{"關閉", ""}, {"開啟", "on"},
+	}},
+}
+
+// getSettings 取出事件來源的設定，群組裡只套用群組的分類；查詢失敗時使用預設值
+func getSettings(event *linebot.Event) *controllers.Settings {
+	if getGroupId(event.Source) != "" {
+		return &controllers.Settings{Categories: getCategories(event)}
+	}
+	settings, err := controllers.GetSettings(meta, event.Source.UserID)
+	if err != nil {
+		meta.Log.Println("Unable to get settings", err)
+		return &controllers.Settings{UserId: event.Source.UserID}
+	}
+	return settings
+}
+
+// getPageSize 回傳使用者設定的筆數，沒有設定或超過 limit 時回傳 limit
+func getPageSize(settings *controllers.Settings, limit int) int {
+	if settings.PageSize > 0 && settings.PageSize < limit {
+		return settings.PageSize
+	}
+	return limit
+}
+
+// sortArticles 依使用者設定的排序重新排列查詢結果，預設排序時不變
+func sortArticles(records []models.ArticleDocument, order string) {
+	switch order {
+	case controllers.OrderPush:
+		sort.SliceStable(records, func(i, j int) bool {
+			return records[i].MessageCount.Push > records[j].MessageCount.Push
+		})
+	case controllers.OrderDate:
+		sort.SliceStable(records, func(i, j int) bool {
+			return records[i].Timestamp > records[j].Timestamp
+		})
+	}
+}
+
+// getUserSettings 從 GetAllSettings 的結果取出使用者的設定，沒有設定過時回傳預設值
+func getUserSettings(all map[string]*controllers.Settings, userId string) *controllers.Settings {
+	if settings, ok := all[userId]; ok {
+		return settings
+	}
+	return &controllers.Settings{UserId: userId}
+}
+
+// getSettingsKey 影響查詢結果的設定相同時 key 相同，推播時用來共用查詢結果
+func getSettingsKey(settings *controllers.Settings) string {
+	return fmt.Sprintf("%s|%t|%d|%s", strings.Join(settings.Categories, ","), settings.SafeMode, settings.PageSize, settings.Order)
+}
+
+// filterArticles 去掉不符合安全模式的文章，最多留下 count 篇
+func filterArticles(records []models.ArticleDocument, filter controllers.ArticleFilter, count int) []models.ArticleDocument {
+	results := []models.ArticleDocument{}
+	for _, record := range records {
+		if len(results) < count && filter.Allow(record) {
+			results = append(results, record)
+		}
+	}
+	return results
+}
+
+// getSettingValue 把目前的設定轉成選項的值
+func getSettingValue(settings *controllers.Settings, field string) string {
+	switch field {
+	case controllers.SettingCategories:
+		return strings.Join(settings.Categories, ",")
+	case controllers.SettingPageSize:
+		if settings.PageSize > 0 {
+			return strconv.Itoa(settings.PageSize)
+		}
+	case controllers.SettingOrder:
+		return settings.Order
+	case controllers.SettingNoDigest:
+		if settings.NoDigest {
+			return "on"
+		}
+	case controllers.SettingLanguage:
+		return settings.Language
+	case controllers.SettingSafeMode:
+		if settings.SafeMode {
+			return "on"
+		}
+	}
+	return ""
+}
+
+// getOptionLabel 回傳選項在該語言的名稱，空值對應訊息目錄裡的 "default"
+func getOptionLabel(field string, option settingOption, locale string) string {
+	value := option.value
+	if value == "" {
+		value = "default"
+	}
+	return localize(locale, "setting."+field+"."+value, option.label)
+}
+
+// getSettingLabel 找出值對應的選項名稱，不在選項裡時直接顯示值
+func getSettingLabel(field string, value string, locale string) string {
+	for _, d := range settingDefinitions {
+		if d.field != field {
+			continue
+		}
+		for _, option := range d.options {
+			if option.value == value {
+				return getOptionLabel(field, option, locale)
+			}
+		}
+	}
+	return value
+}
+
+func isSettingOption(field string, value string) bool {
+	for _, d := range settingDefinitions {
+		if d.field != field {
+			continue
+		}
+		for _, option := range d.options {
+			if option.value == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sendSettings 回覆目前的設定，快速回覆可以選擇要修改的項目。titleKey 是訊息目錄的 key，
+// 改了語言之後會直接用新的語言回覆
+func sendSettings(event *linebot.Event, titleKey string) {
+	settings := getSettings(event)
+	locale := getSettingsLocale(settings)
+	lines := []string{tr(locale, titleKey)}
+	buttons := []*linebot.QuickReplyButton{}
+	for _, d := range settingDefinitions {
+		label := localize(locale, "setting."+d.field, d.label)
+		lines = append(lines, fmt.Sprintf("・%s：%s", label, getSettingLabel(d.field, getSettingValue(settings, d.field), locale)))
+		data := postbackData(&Postback{Action: CodeSettingOption, Setting: d.field})
+		buttons = append(buttons, linebot.NewQuickReplyButton("", linebot.NewPostbackAction(label, data, "", label)))
+	}
+	message := linebot.NewTextMessage(strings.Join(lines, "\n")).WithQuickReplies(newQuickReplyItems(buttons...))
+	replyMessage(event, message)
+}
+
+func actionSettings(event *linebot.Event, pb *Postback) {
+	if getGroupId(event.Source) != "" {
+		sendTextMessage(event, tr(getLocale(event), "settings.group", groupTriggerPrefix, GroupCommandStatus))
+		return
+	}
+	sendSettings(event, "settings.title")
+}
+
+// actionSettingOption 列出某個設定可以選的值
+func actionSettingOption(event *linebot.Event, pb *Postback) {
+	if getGroupId(event.Source) != "" {
+		return
+	}
+	for _, d := range settingDefinitions {
+		if d.field != pb.Setting {
+			continue
+		}
+		settings := getSettings(event)
+		locale := getSettingsLocale(settings)
+		current := getSettingValue(settings, d.field)
+		buttons := []*linebot.QuickReplyButton{}
+		for _, option := range d.options {
+			text := getOptionLabel(d.field, option, locale)
+			label := text
+			if option.value == current {
+				label = "✔ " + label
+			}
+			data := postbackData(&Postback{Action: CodeSetSetting, Setting: d.field, Value: option.value})
+			buttons = append(buttons, linebot.NewQuickReplyButton("", linebot.NewPostbackAction(label, data, "", text)))
+		}
+		prompt := tr(locale, "settings.choose", localize(locale, "setting."+d.field, d.label))
+		message := linebot.NewTextMessage(prompt).WithQuickReplies(newQuickReplyItems(buttons...))
+		replyMessage(event, message)
+		return
+	}
+	meta.Log.Println("Unknown setting", pb.Setting)
+}
+
+// actionSetSetting 修改設定，只接受選單裡有的值
+func actionSetSetting(event *linebot.Event, pb *Postback) {
+	if getGroupId(event.Source) != "" {
+		return
+	}
+	if !isSettingOption(pb.Setting, pb.Value) {
+		meta.Log.Println("Invalid setting value", pb.Setting, pb.Value)
+		return
+	}
+	var value interface{} = pb.Value
+	switch pb.Setting {
+	case controllers.SettingCategories:
+		categories := []string{}
+		if pb.Value != "" {
+			categories = strings.Split(pb.Value, ",")
+		}
+		value = categories
+	case controllers.SettingPageSize:
+		value, _ = strconv.Atoi(pb.Value)
+	case controllers.SettingNoDigest, controllers.SettingSafeMode:
+		value = pb.Value == "on"
+	}
+	settings := &controllers.Settings{UserId: event.Source.UserID}
+	if err := settings.Set(meta, pb.Setting, value); err != nil {
+		sendTextMessage(event, tr(getLocale(event), "error.setting"))
+		return
+	}
+	sendSettings(event, "settings.updated")
+}
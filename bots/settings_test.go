@@ -0,0 +1,69 @@
+package bots
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mong0520/linebot-ptt-beauty/controllers"
+	"github.com/mong0520/linebot-ptt-beauty/models"
+)
+
+func TestGetPageSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		pageSize int
+		limit    int
+		want     int
+	}{
+		{"not set", 0, 10, 10},
+		{"smaller than limit", 5, 10, 5},
+		{"equal to limit", 10, 10, 10},
+		{"over limit", 20, 9, 9},
+		{"negative", -1, 10, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := &controllers.Settings{PageSize: tt.pageSize}
+			if got := getPageSize(settings, tt.limit); got != tt.want {
+				t.Errorf("getPageSize(%d, %d) = %d, want %d", tt.pageSize, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortArticles(t *testing.T) {
+	article := func(id string, push int, timestamp int) models.ArticleDocument {
+		record := models.ArticleDocument{ArticleID: id, Timestamp: timestamp}
+		record.MessageCount.Push = push
+		return record
+	}
+	records := []models.ArticleDocument{
+		article("a", 10, 300),
+		article("b", 30, 100),
+		article("c", 10, 200),
+		article("d", 20, 400),
+	}
+	tests := []struct {
+		name  string
+		order string
+		want  []string
+	}{
+		{"default keeps query order", "", []string{"a", "b", "c", "d"}},
+		{"unknown keeps query order", "unknown", []string{"a", "b", "c", "d"}},
+		{"by push keeps ties stable", controllers.OrderPush, []string{"b", "d", "a", "c"}},
+		{"by date", controllers.OrderDate, []string{"d", "a", "c", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sorted := append([]models.ArticleDocument{}, records...)
+			sortArticles(sorted, tt.order)
+			got := []string{}
+			for _, record := range sorted {
+				got = append(got, record.ArticleID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sortArticles(%q) = %v, want %v", tt.order, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package bots
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/mong0520/linebot-ptt-beauty/controllers"
+)
+
+const (
+	CodeViewShare ActionCode = "sv"
+	CodeCopyShare ActionCode = "sp"
+)
+
+// 分享的文字指令，例如「分享收藏夾 長髮」、「看分享 K7PX3M」，沒有名稱時代表全部最愛；只有中文指令
+const (
+	ShareCreateCommand string = "分享收藏夾"
+	ShareViewCommand   string = "看分享"
+	ShareRevokeCommand string = "取消分享"
+)
+
+func init() {
+	registerRoute(&Route{Code: CodeViewShare, Label: ShareViewCommand, Help: "瀏覽分享的收藏夾", Handler: actionViewShare})
+	registerRoute(&Route{Code: CodeCopyShare, Label: ActionCopyShare, Help: "把分享的收藏夾加入最愛", Handler: actionCopyShare})
+}
+
+// getShareURI 產生開啟聊天室並帶入「看分享 分享碼」的連結，沒有設定 BotBasicID (例如 @abc1234) 時回傳空字串
+func getShareURI(code string) string {
+	basicId := strings.TrimSpace(os.Getenv("BotBasicID"))
+	if basicId == "" {
+		return ""
+	}
+	text := url.PathEscape(fmt.Sprintf("%s %s", ShareViewCommand, code))
+	return fmt.Sprintf("https://line.me/R/oaMessage/%s/?%s", basicId, text)
+}
+
+// shareTextHandler 處理分享的文字指令，回傳是否有處理
+func shareTextHandler(event *linebot.Event, message string) bool {
+	fields := strings.Fields(message)
+	if len(fields) == 0 {
+		return false
+	}
+	locale := getLocale(event)
+	switch fields[0] {
+	case ShareViewCommand:
+		if len(fields) != 2 {
+			sendTextMessage(event, tr(locale, "share.usage", ShareViewCommand))
+			return true
+		}
+		showShare(event, strings.ToUpper(fields[1]), 0)
+		return true
+	case ShareCreateCommand, ShareRevokeCommand:
+	default:
+		return false
+	}
+
+	if getGroupId(event.Source) != "" {
+		sendTextMessage(event, tr(locale, "share.private_only"))
+		return true
+	}
+	userData, err := getUserFavorite(event.Source.UserID)
+	if err != nil {
+		sendTextMessage(event, tr(locale, "error.setting"))
+		return true
+	}
+	collectionId := ""
+	name := tr(locale, "share.all_favorites")
+	if len(fields) > 1 && fields[1] != CollectionAll {
+		collection := userData.GetCollectionByName(fields[1])
+		if collection == nil {
+			sendTextMessage(event, tr(locale, "collection.not_found", fields[1]))
+			return true
+		}
+		collectionId = collection.Id
+		name = tr(locale, "share.collection_name", collection.Name)
+	}
+
+	if fields[0] == ShareRevokeCommand {
+		if revoked, err := controllers.RevokeShare(meta, userData.UserId, collectionId); err != nil {
+			sendTextMessage(event, tr(locale, "error.setting"))
+		} else if !revoked {
+			sendTextMessage(event, tr(locale, "share.not_shared", name))
+		} else {
+			sendTextMessage(event, tr(locale, "share.revoked", name))
+		}
+		return true
+	}
+
+	share, err := controllers.CreateShare(meta, userData.UserId, collectionId)
+	if err != nil {
+		sendTextMessage(event, tr(locale, "error.setting"))
+		return true
+	}
+	text := tr(locale, "share.created", name, share.Code, ShareViewCommand, share.Code)
+	if uri := getShareURI(share.Code); uri != "" {
+		text += "\n\n" + tr(locale, "share.link", uri)
+	}
+	revokeCommand := strings.Join(append([]string{ShareRevokeCommand}, fields[1:]...), " ")
+	text += "\n\n" + tr(locale, "share.revoke_hint", revokeCommand)
+	sendTextMessage(event, text)
+	return true
+}
+
+// getSharedArticleIds 取出分享的文章，分享不存在或收藏夾被刪掉時回覆並回傳 false
+func getSharedArticleIds(event *linebot.Event, code string) (articleIds []string, name string, ok bool) {
+	share, err := controllers.GetShare(meta, code)
+	if err == nil {
+		articleIds, name, err = share.GetArticleIds(meta)
+	}
+	if err == controllers.ErrShareNotFound {
+		sendTextMessage(event, tr(getLocale(event), "share.not_found", code))
+		return nil, "", false
+	} else if err != nil {
+		sendTextMessage(event, tr(getLocale(event), "error.query"))
+		return nil, "", false
+	}
+	return articleIds, name, true
+}
+
+// showShare 唯讀顯示分享的收藏夾，卡片上的最愛按鈕是看的人自己的最愛，擁有者的備註不會顯示
+func showShare(event *linebot.Event, code string, page int) {
+	articleIds, name, ok := getSharedArticleIds(event, code)
+	if !ok {
+		return
+	}
+	locale := getLocale(event)
+	columnCount := getPageSize(getSettings(event), 9)
+	records, lastPage, err := controllers.GetFavoriteArticles(meta.Collection, articleIds, controllers.FavoriteSortAdded, page, columnCount)
+	if err != nil {
+		meta.Log.Println("Unable to get shared articles", code, err)
+		sendTextMessage(event, tr(locale, "error.query"))
+		return
+	}
+	found := records[:0]
+	for _, record := range records {
+		if !isMissingArticle(record) {
+			found = append(found, record)
+		}
+	}
+	if len(found) == 0 {
+		sendTextMessage(event, tr(locale, "collection.empty"))
+		return
+	}
+	altText := tr(locale, "alt.share")
+	if name != "" {
+		altText = tr(locale, "alt.share_collection", name)
+	}
+	carousel := newArticleCarousel(event, found)
+	carousel.nav = newPageNav(&Postback{Action: CodeViewShare, Share: code}, page, lastPage)
+	if getGroupId(event.Source) == "" {
+		label := actionLabel(CodeCopyShare, locale)
+		data := postbackData(&Postback{Action: CodeCopyShare, Share: code})
+		carousel.replies = []*linebot.QuickReplyButton{
+			linebot.NewQuickReplyButton("", linebot.NewPostbackAction(label, data, "", label)),
+		}
+	}
+	sendArticles(event, carousel, altText)
+}
+
+func actionViewShare(event *linebot.Event, pb *Postback) {
+	if pb.Share == "" {
+		return
+	}
+	showShare(event, pb.Share, pb.Page)
+}
+
+// actionCopyShare 把分享的文章全部加入自己的最愛，已經有的略過
+func actionCopyShare(event *linebot.Event, pb *Postback) {
+	if getGroupId(event.Source) != "" || pb.Share == "" {
+		return
+	}
+	articleIds, _, ok := getSharedArticleIds(event, pb.Share)
+	if !ok {
+		return
+	}
+	locale := getLocale(event)
+	userFavorite := &controllers.UserFavorite{UserId: event.Source.UserID}
+	count, err := userFavorite.CopyFavorites(meta, articleIds)
+	if err != nil {
+		sendTextMessage(event, tr(locale, "error.setting"))
+		return
+	}
+	sendTextMessage(event, tr(locale, "share.copied", count, len(articleIds)-count))
+}
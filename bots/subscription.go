@@ -0,0 +1,343 @@
+package bots
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/mong0520/linebot-ptt-beauty/controllers"
+	"github.com/mong0520/linebot-ptt-beauty/utils"
+)
+
+const (
+	CodeSubscription ActionCode = "sl"
+	CodeSubscribe    ActionCode = "sa"
+	CodeUnsubscribe  ActionCode = "sx"
+)
+
+// 訂閱相關的文字指令，例如「訂閱 新垣結衣」、「訂閱 作者 ckpot」、「勿擾 23:00-08:00」，
+// 各語言都用同一組中文指令
+const (
+	SubscribeCommand   string = "訂閱"
+	UnsubscribeCommand string = "取消訂閱"
+	QuietHoursCommand  string = "勿擾"
+	SubscribeAuthor    string = "作者"
+	SubscribeCategory  string = "分類"
+	QuietHoursOff      string = "關閉"
+)
+
+func init() {
+	registerRoute(&Route{Code: CodeSubscription, Label: ActionSubscription, Triggers: []string{ActionSubscription},
+		Help: "新文章通知", MenuOrder: 130, Handler: actionSubscription})
+	registerRoute(&Route{Code: CodeSubscribe, Label: ActionSubscribe, Help: "訂閱", Handler: actionSubscribe})
+	registerRoute(&Route{Code: CodeUnsubscribe, Label: ActionUnsubscribe, Help: "取消訂閱", Handler: actionSubscribe})
+}
+
+var subscriptionJobName = "subscription"
+var subscriptionPollInterval = 5 * time.Minute
+
+// 每次檢查最多處理的新文章數，多的下一輪再處理
+var subscriptionBatchSize = 200
+var maxSubscriptions = 20
+var maxSubscriptionLength = 20
+
+// 每個使用者每天最多收到幾次新文章通知
+var maxSubscriptionPushesPerDay = 5
+
+func getSubscriptionTips(locale string) string {
+	return tr(locale, "subscription.tips",
+		SubscribeCommand, SubscribeCommand, SubscribeAuthor, SubscribeCommand, SubscribeCategory,
+		QuietHoursCommand, QuietHoursCommand, QuietHoursOff)
+}
+
+// subscriptionTextHandler 處理訂閱相關的文字指令，回傳是否有處理
+func subscriptionTextHandler(event *linebot.Event, message string) bool {
+	fields := strings.Fields(message)
+	if len(fields) == 0 {
+		return false
+	}
+	command, args := fields[0], fields[1:]
+	if command != SubscribeCommand && command != UnsubscribeCommand && command != QuietHoursCommand {
+		return false
+	}
+	if getGroupId(event.Source) != "" || event.Source.UserID == "" {
+		sendTextMessage(event, tr(getLocale(event), "subscription.private_only"))
+		return true
+	}
+	if len(args) == 0 {
+		sendTextMessage(event, getSubscriptionTips(getLocale(event)))
+		return true
+	}
+	if command == QuietHoursCommand {
+		setQuietHours(event, args[0])
+		return true
+	}
+	kind, value := controllers.SubscribeKeyword, strings.Join(args, " ")
+	if len(args) > 1 && args[0] == SubscribeAuthor {
+		kind, value = controllers.SubscribeAuthor, args[1]
+	} else if len(args) > 1 && args[0] == SubscribeCategory {
+		kind, value = controllers.SubscribeCategory, args[1]
+	}
+	subscribe(event, kind, value, command == SubscribeCommand)
+	return true
+}
+
+func actionSubscribe(event *linebot.Event, pb *Postback) {
+	kind, value := controllers.SubscribeKeyword, pb.Keyword
+	if pb.Author != "" {
+		kind, value = controllers.SubscribeAuthor, pb.Author
+	} else if pb.Category != "" {
+		kind, value = controllers.SubscribeCategory, pb.Category
+	}
+	if value == "" {
+		meta.Log.Println("Empty subscription", pb)
+		return
+	}
+	subscribe(event, kind, value, pb.Action == CodeSubscribe)
+}
+
+func subscribe(event *linebot.Event, kind string, value string, enable bool) {
+	locale := getLocale(event)
+	subscription := &controllers.Subscription{UserId: event.Source.UserID}
+	if !enable {
+		if err := subscription.Remove(meta, kind, value); err != nil {
+			sendTextMessage(event, tr(locale, "error.setting"))
+			return
+		}
+		sendTextMessage(event, tr(locale, "subscription.removed", value))
+		return
+	}
+
+	if utf8.RuneCountInString(value) > maxSubscriptionLength {
+		sendTextMessage(event, tr(locale, "subscription.too_long", maxSubscriptionLength))
+		return
+	}
+	current, err := subscription.Get(meta)
+	if err != nil {
+		sendTextMessage(event, tr(locale, "error.setting"))
+		return
+	}
+	if current.Count() >= maxSubscriptions {
+		sendTextMessage(event, tr(locale, "subscription.too_many", maxSubscriptions))
+		return
+	}
+	if err := subscription.Add(meta, kind, value); err != nil {
+		sendTextMessage(event, tr(locale, "error.setting"))
+		return
+	}
+	sendTextMessage(event, tr(locale, "subscription.added", value))
+}
+
+func setQuietHours(event *linebot.Event, value string) {
+	locale := getLocale(event)
+	subscription := &controllers.Subscription{UserId: event.Source.UserID}
+	if value == QuietHoursOff {
+		if err := subscription.SetQuietHours(meta, "", ""); err != nil {
+			sendTextMessage(event, tr(locale, "error.setting"))
+			return
+		}
+		sendTextMessage(event, tr(locale, "subscription.quiet_off"))
+		return
+	}
+	clocks := strings.Split(value, "-")
+	if len(clocks) != 2 {
+		sendTextMessage(event, getSubscriptionTips(locale))
+		return
+	}
+	for _, clock := range clocks {
+		if _, _, err := parseClock(clock); err != nil {
+			sendTextMessage(event, getSubscriptionTips(locale))
+			return
+		}
+	}
+	if err := subscription.SetQuietHours(meta, clocks[0], clocks[1]); err != nil {
+		sendTextMessage(event, tr(locale, "error.setting"))
+		return
+	}
+	sendTextMessage(event, tr(locale, "subscription.quiet_set", clocks[0], clocks[1]))
+}
+
+// actionSubscription 列出目前的訂閱，快速回覆按鈕可以直接取消
+func actionSubscription(event *linebot.Event, pb *Postback) {
+	locale := getLocale(event)
+	subscription := &controllers.Subscription{UserId: event.Source.UserID}
+	current, err := subscription.Get(meta)
+	if err != nil {
+		sendTextMessage(event, tr(locale, "error.query"))
+		return
+	}
+	if current.Count() == 0 {
+		sendTextMessage(event, tr(locale, "subscription.empty")+"\n"+getSubscriptionTips(locale))
+		return
+	}
+
+	lines := []string{tr(locale, "subscription.title")}
+	buttons := []*linebot.QuickReplyButton{}
+	addButton := func(text string, unsubscribe *Postback) {
+		lines = append(lines, "・"+text)
+		// 快速回覆最多 13 個
+		if len(buttons) < 13 {
+			label := utils.TruncateRunes(tr(locale, "subscription.cancel", text), maxActionLabelLength)
+			buttons = append(buttons, linebot.NewQuickReplyButton("",
+				linebot.NewPostbackAction(label, postbackData(unsubscribe), "", "")))
+		}
+	}
+	for _, keyword := range current.Keywords {
+		addButton(keyword, &Postback{Action: CodeUnsubscribe, Keyword: keyword})
+	}
+	for _, author := range current.Authors {
+		addButton(SubscribeAuthor+" "+author, &Postback{Action: CodeUnsubscribe, Author: author})
+	}
+	for _, category := range current.Categories {
+		addButton(SubscribeCategory+" "+category, &Postback{Action: CodeUnsubscribe, Category: category})
+	}
+	if current.QuietStart != "" {
+		lines = append(lines, "\n"+tr(locale, "subscription.quiet_hours", current.QuietStart, current.QuietEnd))
+	}
+	message := linebot.NewTextMessage(strings.Join(lines, "\n")).WithQuickReplies(newQuickReplyItems(buttons...))
+	replyMessage(event, message)
+}
+
+func startSubscriptionJob() {
+	runEvery("subscription", subscriptionPollInterval, func() {
+		matchNewArticles()
+		deliverSubscriptions(time.Now())
+	})
+}
+
+// matchNewArticles 比對上次檢查之後匯入的文章，符合的先放進各使用者的待推播清單
+func matchNewArticles() {
+	state, err := controllers.GetJobState(meta, subscriptionJobName)
+	if err != nil {
+		meta.Log.Println("Unable to get subscription job state", err)
+		return
+	}
+	if state == nil {
+		// 第一次執行，從現在開始比對，不推播舊文章
+		latest, err := controllers.GetLatestArticleId(meta.Collection)
+		if err != nil {
+			meta.Log.Println("Unable to get latest article", err)
+			return
+		}
+		state = &controllers.JobState{Name: subscriptionJobName, Cursor: latest}
+		state.Save(meta)
+		return
+	}
+
+	subscriptions, err := controllers.GetAllSubscriptions(meta)
+	if err != nil {
+		meta.Log.Println("Unable to get subscriptions", err)
+		return
+	}
+	inactive, err := controllers.GetInactiveUserIds(meta)
+	if err != nil {
+		meta.Log.Println("Unable to get inactive users", err)
+		return
+	}
+	allSettings, err := controllers.GetAllSettings(meta)
+	if err != nil {
+		meta.Log.Println("Unable to get settings", err)
+		return
+	}
+	for {
+		articles, err := controllers.GetNewArticles(meta.Collection, state.Cursor, subscriptionBatchSize)
+		if err != nil {
+			meta.Log.Println("Unable to get new articles", err)
+			return
+		}
+		if len(articles) == 0 {
+			return
+		}
+		matched := map[string][]string{}
+		for idx := range articles {
+			for _, s := range subscriptions {
+				filter := getUserSettings(allSettings, s.UserId).Filter()
+				if !inactive[s.UserId] && filter.Allow(articles[idx]) && s.Match(&articles[idx]) {
+					matched[s.UserId] = append(matched[s.UserId], articles[idx].ArticleID)
+				}
+			}
+		}
+		for userId, articleIds := range matched {
+			subscription := &controllers.Subscription{UserId: userId}
+			subscription.AddPending(meta, articleIds, maxCountOfCarousel)
+		}
+		meta.Log.Printf("Match %d new articles for %d users\n", len(articles), len(matched))
+		state.Cursor = articles[len(articles)-1].ID
+		if err := state.Save(meta); err != nil || len(articles) < subscriptionBatchSize {
+			return
+		}
+	}
+}
+
+// deliverSubscriptions 推播待推播清單，勿擾時段或超過每日上限的留到下一輪
+func deliverSubscriptions(now time.Time) {
+	subscriptions, err := controllers.GetPendingSubscriptions(meta)
+	if err != nil {
+		meta.Log.Println("Unable to get pending subscriptions", err)
+		return
+	}
+	inactive, err := controllers.GetInactiveUserIds(meta)
+	if err != nil {
+		meta.Log.Println("Unable to get inactive users", err)
+		return
+	}
+	allSettings, err := controllers.GetAllSettings(meta)
+	if err != nil {
+		meta.Log.Println("Unable to get settings, push in default language", err)
+	}
+	today := now.In(utils.GetTaipeiLocation()).Format("2006-01-02")
+	for idx := range subscriptions {
+		s := &subscriptions[idx]
+		if inactive[s.UserId] {
+			s.ClearPending(meta, s.Pending)
+			continue
+		}
+		if inQuietHours(s, now) {
+			continue
+		}
+		records, err := controllers.GetByIds(meta.Collection, s.Pending)
+		if err != nil {
+			meta.Log.Println("Unable to get pending articles", err)
+			continue
+		}
+		if len(records) > 0 {
+			// 先佔用次數再推播，多個工作同時執行也不會超過上限；推播失敗時歸還
+			if ok, err := s.ReservePush(meta, today, maxSubscriptionPushesPerDay); err != nil || !ok {
+				continue
+			}
+			locale := getSettingsLocale(getUserSettings(allSettings, s.UserId))
+			carousel := &articleCarousel{userId: s.UserId, records: records, locale: locale}
+			message := renderArticles(carousel, tr(locale, "alt.subscription"))
+			if err := pushMessage(s.UserId, message); err != nil {
+				meta.Log.Println("Push subscription fail", utils.RedactID(s.UserId), err)
+				s.ReleasePush(meta, today)
+				continue
+			}
+		}
+		s.ClearPending(meta, s.Pending)
+	}
+}
+
+// inQuietHours 判斷現在 (台灣時間) 是否在勿擾時段，時段可以跨過午夜
+func inQuietHours(s *controllers.Subscription, now time.Time) bool {
+	if s.QuietStart == "" || s.QuietEnd == "" {
+		return false
+	}
+	startHour, startMinute, err := parseClock(s.QuietStart)
+	if err != nil {
+		return false
+	}
+	endHour, endMinute, err := parseClock(s.QuietEnd)
+	if err != nil {
+		return false
+	}
+	now = now.In(utils.GetTaipeiLocation())
+	current := now.Hour()*60 + now.Minute()
+	start := startHour*60 + startMinute
+	end := endHour*60 + endMinute
+	if start <= end {
+		return current >= start && current < end
+	}
+	return current >= start || current < end
+}
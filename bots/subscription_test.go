@@ -0,0 +1,45 @@
+package bots
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mong0520/linebot-ptt-beauty/controllers"
+	"github.com/mong0520/linebot-ptt-beauty/utils"
+)
+
+func TestInQuietHours(t *testing.T) {
+	taipei := utils.GetTaipeiLocation()
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 1, 1, hour, minute, 0, 0, taipei)
+	}
+	tests := []struct {
+		name  string
+		start string
+		end   string
+		now   time.Time
+		quiet bool
+	}{
+		{"not set", "", "", at(23, 30), false},
+		{"only start", "23:00", "", at(23, 30), false},
+		{"invalid clock", "25:00", "08:00", at(23, 30), false},
+		{"same day inside", "12:00", "14:00", at(13, 0), true},
+		{"same day at start", "12:00", "14:00", at(12, 0), true},
+		{"same day at end", "12:00", "14:00", at(14, 0), false},
+		{"same day outside", "12:00", "14:00", at(15, 0), false},
+		{"across midnight before midnight", "23:00", "08:00", at(23, 30), true},
+		{"across midnight after midnight", "23:00", "08:00", at(2, 0), true},
+		{"across midnight at start", "23:00", "08:00", at(23, 0), true},
+		{"across midnight at end", "23:00", "08:00", at(8, 0), false},
+		{"across midnight daytime", "23:00", "08:00", at(12, 0), false},
+		{"utc time is converted", "23:00", "08:00", time.Date(2024, 1, 1, 16, 30, 0, 0, time.UTC), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &controllers.Subscription{QuietStart: tt.start, QuietEnd: tt.end}
+			if got := inQuietHours(s, tt.now); got != tt.quiet {
+				t.Errorf("inQuietHours(%s-%s, %s) = %v, want %v", tt.start, tt.end, tt.now.Format("15:04"), got, tt.quiet)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package bots
+
+import (
+	"fmt"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/mong0520/linebot-ptt-beauty/controllers"
+	"github.com/mong0520/linebot-ptt-beauty/utils"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const CodeSummary ActionCode = "sm"
+
+func init() {
+	registerRoute(&Route{Code: CodeSummary, Label: ActionSummary, Help: "看文章內容", Handler: actionSummary})
+}
+
+// 文章摘要最多顯示的字數
+var maxSummaryLength = 500
+
+func actionSummary(event *linebot.Event, pb *Postback) {
+	articleId := pb.ArticleID
+	locale := getLocale(event)
+	result, err := controllers.GetOne(meta.Collection, bson.M{"article_id": articleId})
+	if err != nil {
+		meta.Log.Println("Unable to get article", articleId, err)
+		sendTextMessage(event, tr(locale, "article.missing"))
+		return
+	}
+	summary := utils.TruncateRunes(utils.CleanArticleContent(result.Content), maxSummaryLength)
+	if summary == "" {
+		summary = tr(locale, "summary.images_only")
+	}
+	text := fmt.Sprintf("📝 %s\n\n%s\n\n%s %s", result.ArticleTitle, summary, tr(locale, "card.click"), result.URL)
+	sendTextMessage(event, text)
+}
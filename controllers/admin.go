@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/mong0520/linebot-ptt-beauty/models"
+	"github.com/mong0520/linebot-ptt-beauty/utils"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type AuditLog struct {
+	UserId    string    `json:"user_id" bson:"user_id"`
+	Command   string    `json:"command" bson:"command"`
+	Args      []string  `json:"args" bson:"args"`
+	Allowed   bool      `json:"allowed" bson:"allowed"`
+	Result    string    `json:"result" bson:"result"`
+	Error     string    `json:"error" bson:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+type Stats struct {
+	Articles           int
+	Users              int
+	ActiveUsers        int
+	OnThisDaySubscribe int
+	LeaderboardUpdated time.Time
+}
+
+func (a *AuditLog) Add(meta *models.Model) (err error) {
+	a.CreatedAt = time.Now()
+	if err := meta.CollectionAudit.Insert(a); err != nil {
+		meta.Log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func GetStats(meta *models.Model) (stats *Stats, err error) {
+	stats = &Stats{LeaderboardUpdated: GetLeaderboard().UpdatedAt}
+	if stats.Articles, err = meta.Collection.Count(); err != nil {
+		return nil, err
+	}
+	if stats.Users, err = meta.CollectionUserFavorite.Count(); err != nil {
+		return nil, err
+	}
+	if stats.ActiveUsers, err = meta.CollectionUserFavorite.Find(bson.M{"inactive": activeUser}).Count(); err != nil {
+		return nil, err
+	}
+	if stats.OnThisDaySubscribe, err = meta.CollectionUserFavorite.Find(bson.M{"on_this_day": true}).Count(); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// GetAllUserIds 取出所有沒有封鎖機器人的使用者，給廣播使用
+func GetAllUserIds(meta *models.Model) (userIds []string, err error) {
+	if err := meta.CollectionUserFavorite.Find(bson.M{"inactive": activeUser}).Distinct("user_id", &userIds); err != nil {
+		return nil, err
+	}
+	return userIds, nil
+}
+
+// EnsureIndexes 建立查詢會用到的索引，已存在時不會重建。先建機器人自己的 collection，
+// 再建爬蟲的 ptt.beauty；某個索引失敗時記錄下來繼續建其他的，最後回傳第一個錯誤
+func EnsureIndexes(meta *models.Model) (err error) {
+	if dedupeErr := dedupeUsers(meta); dedupeErr != nil {
+		meta.Log.Println("Unable to dedupe users", dedupeErr)
+		err = dedupeErr
+	}
+	indexes := []struct {
+		collection *mgo.Collection
+		index      mgo.Index
+	}{
+		{meta.CollectionUserFavorite, mgo.Index{Key: []string{"user_id"}, Unique: true}},
+		{meta.CollectionGroup, mgo.Index{Key: []string{"group_id"}, Unique: true}},
+		{meta.CollectionSubscription, mgo.Index{Key: []string{"user_id"}, Unique: true}},
+		{meta.CollectionDigest, mgo.Index{Key: []string{"user_id"}, Unique: true}},
+		{meta.CollectionSettings, mgo.Index{Key: []string{"user_id"}, Unique: true}},
+		{meta.CollectionDelivery, mgo.Index{Key: []string{"user_id", "-created_at"}}},
+		{meta.CollectionShare, mgo.Index{Key: []string{"user_id", "collection_id"}, Unique: true}},
+		{meta.CollectionAudit, mgo.Index{Key: []string{"-created_at"}}},
+		{meta.CollectionExport, mgo.Index{Key: []string{"expires_at"}, ExpireAfter: time.Second}},
+		// ptt.beauty 是爬蟲寫入的，不加唯一索引，避免爬蟲寫入重複文章時失敗
+		{meta.Collection, mgo.Index{Key: []string{"article_id"}}},
+		{meta.Collection, mgo.Index{Key: []string{"-timestamp"}}},
+		{meta.Collection, mgo.Index{Key: []string{"-message_count.push"}}},
+		{meta.Collection, mgo.Index{Key: []string{"author"}}},
+	}
+	for _, i := range indexes {
+		if indexErr := i.collection.EnsureIndex(i.index); indexErr != nil {
+			meta.Log.Printf("Unable to ensure index %v on %s: %v\n", i.index.Key, i.collection.FullName, indexErr)
+			if err == nil {
+				err = indexErr
+			}
+		}
+	}
+	return err
+}
+
+// dedupeUsers 合併重複的使用者記錄，user_id 的唯一索引建立前必須先處理
+func dedupeUsers(meta *models.Model) (err error) {
+	pipeline := []bson.M{
+		{"$group": bson.M{"_id": "$user_id", "ids": bson.M{"$push": "$_id"}, "count": bson.M{"$sum": 1}}},
+		{"$match": bson.M{"count": bson.M{"$gt": 1}}},
+	}
+	duplicates := []struct {
+		UserId string          `bson:"_id"`
+		Ids    []bson.ObjectId `bson:"ids"`
+	}{}
+	if err := meta.CollectionUserFavorite.Pipe(pipeline).All(&duplicates); err != nil {
+		return err
+	}
+	for _, d := range duplicates {
+		favorites := []FavoriteItem{}
+		exists := map[string]bool{}
+		for _, id := range d.Ids {
+			record := &UserFavorite{}
+			if err := meta.CollectionUserFavorite.FindId(id).One(record); err != nil {
+				return err
+			}
+			for _, f := range record.Favorites {
+				if !exists[f.ArticleId] {
+					exists[f.ArticleId] = true
+					favorites = append(favorites, f)
+				}
+			}
+		}
+		update := bson.M{"$set": bson.M{"favorites": favorites}}
+		if err := meta.CollectionUserFavorite.UpdateId(d.Ids[0], update); err != nil {
+			return err
+		}
+		if _, err := meta.CollectionUserFavorite.RemoveAll(bson.M{"_id": bson.M{"$in": d.Ids[1:]}}); err != nil {
+			return err
+		}
+		meta.Log.Printf("Merge %d duplicated records of user %s\n", len(d.Ids)-1, utils.RedactID(d.UserId))
+	}
+	return nil
+}
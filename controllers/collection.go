@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"errors"
+
+	"github.com/mong0520/linebot-ptt-beauty/models"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// FavoriteCollection 是使用者自訂的收藏夾，一篇最愛最多放在一個收藏夾，沒放的就是未分類
+type FavoriteCollection struct {
+	// Id 在改名後不變，postback 用它指定收藏夾
+	Id       string   `json:"id" bson:"id"`
+	Name     string   `json:"name" bson:"name"`
+	Articles []string `json:"articles" bson:"articles"`
+}
+
+var ErrCollectionExists = errors.New("collection name exists")
+var ErrCollectionNotFound = errors.New("collection not found")
+
+// GetCollection 依 id 找出收藏夾
+func (u *UserFavorite) GetCollection(id string) *FavoriteCollection {
+	for idx := range u.Collections {
+		if u.Collections[idx].Id == id {
+			return &u.Collections[idx]
+		}
+	}
+	return nil
+}
+
+// GetCollectionByName 依名稱找出收藏夾
+func (u *UserFavorite) GetCollectionByName(name string) *FavoriteCollection {
+	for idx := range u.Collections {
+		if u.Collections[idx].Name == name {
+			return &u.Collections[idx]
+		}
+	}
+	return nil
+}
+
+// CreateCollection 新增收藏夾，同名時回傳 ErrCollectionExists
+func (u *UserFavorite) CreateCollection(meta *models.Model, name string) (collection *FavoriteCollection, err error) {
+	// 使用者記錄不存在時 Update 也會回傳 ErrNotFound，先建立才分得出是否同名
+	u.Add(meta)
+	collection = &FavoriteCollection{Id: bson.NewObjectId().Hex(), Name: name, Articles: []string{}}
+	query := bson.M{"user_id": u.UserId, "collections.name": bson.M{"$ne": name}}
+	update := bson.M{"$push": bson.M{"collections": collection}}
+	if err := meta.CollectionUserFavorite.Update(query, update); err == mgo.ErrNotFound {
+		return nil, ErrCollectionExists
+	} else if err != nil {
+		meta.Log.Println(err)
+		return nil, err
+	}
+	return collection, nil
+}
+
+func (u *UserFavorite) RenameCollection(meta *models.Model, id string, name string) (err error) {
+	query := bson.M{"user_id": u.UserId, "collections.id": id}
+	update := bson.M{"$set": bson.M{"collections.$.name": name}}
+	if err := meta.CollectionUserFavorite.Update(query, update); err == mgo.ErrNotFound {
+		return ErrCollectionNotFound
+	} else if err != nil {
+		meta.Log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// DeleteCollection 刪除收藏夾，裡面的文章仍留在最愛，變成未分類
+func (u *UserFavorite) DeleteCollection(meta *models.Model, id string) (err error) {
+	query := bson.M{"user_id": u.UserId}
+	update := bson.M{"$pull": bson.M{"collections": bson.M{"id": id}}}
+	if err := meta.CollectionUserFavorite.Update(query, update); err != nil {
+		meta.Log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// MoveFavorite 把文章移到收藏夾，id 為空時移回未分類。文章不在最愛時會一起加入
+func (u *UserFavorite) MoveFavorite(meta *models.Model, articleId string, id string) (err error) {
+	if _, err := u.AddFavorite(meta, articleId); err != nil {
+		return err
+	}
+	if err := u.RemoveFromCollections(meta, articleId); err != nil {
+		return err
+	}
+	if id == "" {
+		return nil
+	}
+	query := bson.M{"user_id": u.UserId, "collections.id": id}
+	update := bson.M{"$addToSet": bson.M{"collections.$.articles": articleId}}
+	if err := meta.CollectionUserFavorite.Update(query, update); err == mgo.ErrNotFound {
+		return ErrCollectionNotFound
+	} else if err != nil {
+		meta.Log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// RemoveFromCollections 把文章從所有收藏夾拿掉
+func (u *UserFavorite) RemoveFromCollections(meta *models.Model, articleId string) (err error) {
+	// $[] 在沒有 collections 欄位的文件上會失敗，所以只更新有收進收藏夾的
+	query := bson.M{"user_id": u.UserId, "collections.articles": articleId}
+	update := bson.M{"$pull": bson.M{"collections.$[].articles": articleId}}
+	if err := meta.CollectionUserFavorite.Update(query, update); err != nil && err != mgo.ErrNotFound {
+		meta.Log.Println(err)
+		return err
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/mong0520/linebot-ptt-beauty/models"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
+	"regexp"
 	"strings"
 	"time"
 	"sort"
@@ -14,7 +15,35 @@ import (
 
 type UserFavorite struct {
     UserId    string   `json:"user_id" bson:"user_id"`
-    Favorites []string `json:"favorites" bson:"favorites"`
+    Favorites []FavoriteItem `json:"favorites" bson:"favorites"`
+    Collections []FavoriteCollection `json:"collections" bson:"collections,omitempty"`
+    OnThisDay bool     `json:"on_this_day" bson:"on_this_day,omitempty"`
+    // Inactive 表示使用者封鎖了機器人，不再推播給他
+    Inactive     bool      `json:"inactive" bson:"inactive,omitempty"`
+    FollowedAt   time.Time `json:"followed_at" bson:"followed_at,omitempty"`
+    UnfollowedAt time.Time `json:"unfollowed_at" bson:"unfollowed_at,omitempty"`
+}
+
+// 推播對象要排除封鎖機器人的使用者
+var activeUser = bson.M{"$ne": true}
+
+// 表特版最早的文章年份，歷史上的今天只往回查到這一年
+var onThisDayFirstYear = 2004
+
+// 沒有指定分類時只查正妹
+var defaultCategories = []string{"正妹"}
+
+// titleRegex 產生比對標題分類 (例如 [正妹]) 的正規表示式，keyword 不為空時標題還要包含它
+func (f ArticleFilter) titleRegex(keyword string) bson.RegEx {
+	categories := f.Categories
+	if len(categories) == 0 {
+		categories = defaultCategories
+	}
+	quoted := []string{}
+	for _, category := range categories {
+		quoted = append(quoted, regexp.QuoteMeta(category))
+	}
+	return bson.RegEx{Pattern: fmt.Sprintf("^%s\\[(%s)\\].*%s.*", f.safePrefix(), strings.Join(quoted, "|"), keyword), Options: ""}
 }
 
 func GetOne(collection *mgo.Collection, query bson.M) (result *models.ArticleDocument, err error) {
@@ -29,8 +58,8 @@ func GetOne(collection *mgo.Collection, query bson.M) (result *models.ArticleDoc
 	}
 }
 
-func Get(collection *mgo.Collection, page int, perPage int) (results []models.ArticleDocument, err error) {
-	query := bson.M{"article_title": bson.M{"$regex": bson.RegEx{"^\\[正妹\\].*", ""}}}
+func Get(collection *mgo.Collection, page int, perPage int, filter ArticleFilter) (results []models.ArticleDocument, err error) {
+	query := bson.M{"article_title": bson.M{"$regex": filter.titleRegex("")}}
 	//document := &models.ArticleDocument{}
 	//results, err = document.GeneralQueryAll(collection, query, "", -1)
 	err = collection.Find(query).Sort("-timestamp").Skip(page*perPage).Limit(perPage).All(&results)
@@ -54,7 +83,7 @@ func GetAll(collection *mgo.Collection, query bson.M) (results []models.ArticleD
 	}
 }
 
-func GetRandom(collection *mgo.Collection, count int, keyword string) (results []models.ArticleDocument, err error) {
+func GetRandom(collection *mgo.Collection, count int, keyword string, filter ArticleFilter) (results []models.ArticleDocument, err error) {
 	//document := &models.ArticleDocument{}
 	//query := bson.M{"message_count.all": bson.M{"$gt": like}, "ArticleTitle": "/正妹/"}
 	//query := bson.M{"ArticleTitle": bson.RegEx{"*", ""}}
@@ -65,11 +94,15 @@ func GetRandom(collection *mgo.Collection, count int, keyword string) (results [
 	baseline_ts := 1420070400 // 2015年Jan/1/00:00:00 之後
 	needRandom := true
 	if keyword == "" {
-		query = bson.M{"timestamp": bson.M{"$gte": baseline_ts}, "article_title": bson.M{"$regex": bson.RegEx{"^\\[正妹\\].*", ""}}}
+		query = bson.M{"timestamp": bson.M{"$gte": baseline_ts}, "article_title": bson.M{"$regex": filter.titleRegex("")}}
+	} else if len(filter.Categories) > 0 {
+		query = bson.M{
+			"timestamp":     bson.M{"$gte": baseline_ts},
+			"article_title": bson.M{"$regex": filter.titleRegex(strings.ToLower(keyword))}}
 	} else {
 		query = bson.M{
 			"timestamp":     bson.M{"$gte": baseline_ts},
-			"article_title": bson.M{"$regex": bson.RegEx{fmt.Sprintf("^(?!\\[公告\\]).*%s.*", strings.ToLower(keyword)), ""}}}
+			"article_title": bson.M{"$regex": bson.RegEx{Pattern: fmt.Sprintf("^%s(?!\\[公告\\]).*%s.*", filter.safePrefix(), strings.ToLower(keyword)), Options: ""}}}
 			// not start with [公告]
 	}
 
@@ -109,7 +142,7 @@ func GetRandom(collection *mgo.Collection, count int, keyword string) (results [
 	}
 }
 
-func GetMostLike(collection *mgo.Collection, count int, timestampOffset int) (results []models.ArticleDocument, err error) {
+func GetMostLike(collection *mgo.Collection, count int, timestampOffset int, filter ArticleFilter) (results []models.ArticleDocument, err error) {
 	document := &models.ArticleDocument{}
 	//query := bson.M{"message_count.all": bson.M{"$gt": like}, "ArticleTitle": "/正妹/"}
 	//query := bson.M{"ArticleTitle": bson.RegEx{"*", ""}}
@@ -120,9 +153,9 @@ func GetMostLike(collection *mgo.Collection, count int, timestampOffset int) (re
 		nowInSec := int(now.Unix())
 		start := nowInSec - timestampOffset
 		//{"timestamp": {"$gte":  1, "$lt": 9999999999}}
-		query = bson.M{"timestamp": bson.M{"$gte": start, "$lt": nowInSec}, "article_title": bson.M{"$regex": bson.RegEx{"^\\[正妹\\].*", ""}}}
+		query = bson.M{"timestamp": bson.M{"$gte": start, "$lt": nowInSec}, "article_title": bson.M{"$regex": filter.titleRegex("")}}
 	} else {
-		query = bson.M{"article_title": bson.M{"$regex": bson.RegEx{"^\\[正妹\\].*", ""}}}
+		query = bson.M{"article_title": bson.M{"$regex": filter.titleRegex("")}}
 	}
 	results, err = document.GeneralQueryAll(collection, query, "-message_count.push", count)
 	if err != nil {
@@ -133,14 +166,74 @@ func GetMostLike(collection *mgo.Collection, count int, timestampOffset int) (re
 	}
 }
 
+// GetOnThisDay 取出往年同月同日(台灣時間)推文數最多的文章
+func GetOnThisDay(collection *mgo.Collection, count int, now time.Time, filter ArticleFilter) (results []models.ArticleDocument, err error) {
+	document := &models.ArticleDocument{}
+	now = now.In(utils.GetTaipeiLocation())
+	windows := []bson.M{}
+	for year := now.Year() - 1; year >= onThisDayFirstYear; year-- {
+		start := time.Date(year, now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		if start.Month() != now.Month() {
+			// 2/29 在非閏年不存在
+			continue
+		}
+		end := start.AddDate(0, 0, 1)
+		windows = append(windows, bson.M{"timestamp": bson.M{"$gte": int(start.Unix()), "$lt": int(end.Unix())}})
+	}
+	if len(windows) == 0 {
+		return nil, errors.New("NotFound")
+	}
+	query := bson.M{"$or": windows, "article_title": bson.M{"$regex": filter.titleRegex("")}}
+	results, err = document.GeneralQueryAll(collection, query, "-message_count.push", count)
+	if err != nil {
+		return nil, err
+	} else {
+		return results, nil
+	}
+}
+
+// Add 建立使用者記錄，已經存在時不做任何事，同時送來的事件也不會建立重複的記錄
 func (u *UserFavorite) Add(meta *models.Model) {
-    if err := meta.CollectionUserFavorite.Insert(u) ; err != nil{
+    favorites := u.Favorites
+    if favorites == nil {
+        favorites = []FavoriteItem{}
+    }
+    query := bson.M{"user_id": u.UserId}
+    update := bson.M{"$setOnInsert": bson.M{"favorites": favorites}}
+    if _, err := meta.CollectionUserFavorite.Upsert(query, update) ; err != nil{
+        meta.Log.Println(err)
+    }
+}
+
+// AddFavorite 把文章加入最愛，回傳 false 代表原本就在最愛裡，重複的 postback 不會有影響
+func (u *UserFavorite) AddFavorite(meta *models.Model, articleId string) (added bool, err error){
+    u.Add(meta)
+    query := bson.M{"user_id": u.UserId, "favorites.article_id": bson.M{"$ne": articleId}}
+    update := bson.M{"$push": bson.M{"favorites": FavoriteItem{ArticleId: articleId, AddedAt: time.Now()}}}
+    if err := meta.CollectionUserFavorite.Update(query, update) ; err == mgo.ErrNotFound{
+        return false, nil
+    }else if err != nil{
+        meta.Log.Println(err)
+        return false, err
+    }
+    return true, nil
+}
+
+// RemoveFavorite 把文章從最愛與收藏夾移除，回傳 false 代表原本就不在最愛裡
+func (u *UserFavorite) RemoveFavorite(meta *models.Model, articleId string) (removed bool, err error){
+    query := bson.M{"user_id": u.UserId, "favorites.article_id": articleId}
+    update := bson.M{"$pull": bson.M{"favorites": bson.M{"article_id": articleId}}}
+    if err := meta.CollectionUserFavorite.Update(query, update) ; err == mgo.ErrNotFound{
+        return false, nil
+    }else if err != nil{
         meta.Log.Println(err)
+        return false, err
     }
+    return true, u.RemoveFromCollections(meta, articleId)
 }
 
 func (u *UserFavorite) Get(meta *models.Model) (result *UserFavorite, err error){
-    meta.Log.Println(u.UserId)
+    meta.Log.Println(utils.RedactID(u.UserId))
     query := bson.M{"user_id": u.UserId}
     if err := meta.CollectionUserFavorite.Find(query).One(&result) ; err != nil{
         meta.Log.Println(err)
@@ -151,12 +244,69 @@ func (u *UserFavorite) Get(meta *models.Model) (result *UserFavorite, err error)
 }
 
 func (u *UserFavorite) Update(meta *models.Model) (err error){
-    meta.Log.Println(u.UserId)
+    meta.Log.Println(utils.RedactID(u.UserId))
     query := bson.M{"user_id": u.UserId}
-    if err := meta.CollectionUserFavorite.Update(query, u) ; err != nil{
+    // 只更新最愛清單，避免覆蓋掉其他欄位
+    update := bson.M{"$set": bson.M{"favorites": u.Favorites}}
+    if err := meta.CollectionUserFavorite.Update(query, update) ; err != nil{
         meta.Log.Println(err)
         return err
     }else{
         return nil
     }
 }
+
+// SetOnThisDay 設定是否每天推播歷史上的今天
+func (u *UserFavorite) SetOnThisDay(meta *models.Model, enable bool) (err error){
+    query := bson.M{"user_id": u.UserId}
+    update := bson.M{"$set": bson.M{"on_this_day": enable}}
+    if _, err := meta.CollectionUserFavorite.Upsert(query, update) ; err != nil{
+        meta.Log.Println(err)
+        return err
+    }
+    u.OnThisDay = enable
+    return nil
+}
+
+// GetOnThisDaySubscribers 取得訂閱歷史上的今天的使用者
+func GetOnThisDaySubscribers(meta *models.Model) (userIds []string, err error){
+    results := []UserFavorite{}
+    query := bson.M{"on_this_day": true, "inactive": activeUser}
+    if err := meta.CollectionUserFavorite.Find(query).All(&results) ; err != nil{
+        meta.Log.Println(err)
+        return nil, err
+    }
+    for _, r := range results{
+        userIds = append(userIds, r.UserId)
+    }
+    return userIds, nil
+}
+
+// Follow 使用者加入好友或解除封鎖時呼叫，還沒有記錄時建立一筆
+func (u *UserFavorite) Follow(meta *models.Model) (err error){
+    query := bson.M{"user_id": u.UserId}
+    update := bson.M{
+        "$set":         bson.M{"inactive": false, "followed_at": time.Now()},
+        "$setOnInsert": bson.M{"favorites": []FavoriteItem{}},
+    }
+    if _, err := meta.CollectionUserFavorite.Upsert(query, update) ; err != nil{
+        meta.Log.Println(err)
+        return err
+    }
+    return nil
+}
+
+// Unfollow 使用者封鎖機器人時呼叫，保留最愛但停止所有推播。還沒有記錄時也建立一筆，
+// 只有訂閱或設定、沒有最愛的使用者才會被 GetExpiredUserIds 找到，在保留期限後刪除
+func (u *UserFavorite) Unfollow(meta *models.Model) (err error){
+    query := bson.M{"user_id": u.UserId}
+    update := bson.M{
+        "$set":         bson.M{"inactive": true, "unfollowed_at": time.Now()},
+        "$setOnInsert": bson.M{"favorites": []FavoriteItem{}},
+    }
+    if _, err := meta.CollectionUserFavorite.Upsert(query, update) ; err != nil{
+        meta.Log.Println(err)
+        return err
+    }
+    return nil
+}
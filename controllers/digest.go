@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/mong0520/linebot-ptt-beauty/models"
+	"github.com/mong0520/linebot-ptt-beauty/utils"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	DigestDaily  string = "daily"
+	DigestWeekly string = "weekly"
+)
+
+// 推播結果
+const (
+	DeliverySent    string = "sent"
+	DeliveryFailed  string = "failed"
+	DeliverySkipped string = "skipped"
+)
+
+// Digest 是使用者的熱門摘要設定，時間都是台灣時間 "HH:MM"，空的代表沒有訂閱
+type Digest struct {
+	UserId     string `json:"user_id" bson:"user_id"`
+	DailyTime  string `json:"daily_time" bson:"daily_time,omitempty"`
+	WeeklyTime string `json:"weekly_time" bson:"weekly_time,omitempty"`
+	// WeeklyDay 是 time.Weekday，0 為星期日
+	WeeklyDay int `json:"weekly_day" bson:"weekly_day"`
+	// 最後送出的日期，避免同一天重複推播。設定時當天的時間已經過了也會填上當天，隔天才開始送
+	DailySent  string `json:"daily_sent" bson:"daily_sent,omitempty"`
+	WeeklySent string `json:"weekly_sent" bson:"weekly_sent,omitempty"`
+}
+
+// Delivery 記錄每一次摘要推播的結果
+type Delivery struct {
+	UserId    string    `json:"user_id" bson:"user_id"`
+	Kind      string    `json:"kind" bson:"kind"`
+	Date      string    `json:"date" bson:"date"`
+	Status    string    `json:"status" bson:"status"`
+	Error     string    `json:"error" bson:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+func (d *Digest) Get(meta *models.Model) (result *Digest, err error) {
+	query := bson.M{"user_id": d.UserId}
+	if err := meta.CollectionDigest.Find(query).One(&result); err == mgo.ErrNotFound {
+		return &Digest{UserId: d.UserId}, nil
+	} else if err != nil {
+		meta.Log.Println(err)
+		return nil, err
+	}
+	return result, nil
+}
+
+// SetDaily 設定每日摘要的時間，clock 為空時取消
+func (d *Digest) SetDaily(meta *models.Model, clock string) (err error) {
+	if clock == "" {
+		return d.upsert(meta, bson.M{"$unset": bson.M{"daily_time": ""}})
+	}
+	update := bson.M{"daily_time": clock}
+	if date, passed := getPassedDate(clock, time.Now()); passed {
+		update["daily_sent"] = date
+	}
+	return d.upsert(meta, bson.M{"$set": update})
+}
+
+// SetWeekly 設定每週摘要的星期與時間，clock 為空時取消
+func (d *Digest) SetWeekly(meta *models.Model, day time.Weekday, clock string) (err error) {
+	if clock == "" {
+		return d.upsert(meta, bson.M{"$unset": bson.M{"weekly_time": ""}})
+	}
+	update := bson.M{"weekly_day": int(day), "weekly_time": clock}
+	now := time.Now()
+	if date, passed := getPassedDate(clock, now); passed && now.In(utils.GetTaipeiLocation()).Weekday() == day {
+		update["weekly_sent"] = date
+	}
+	return d.upsert(meta, bson.M{"$set": update})
+}
+
+// getPassedDate 回傳 now 的日期 (台灣時間)，以及 clock 在這一天是否已經過了。
+// 已經過了的話當作今天送過，否則 GetDueDigests 會在設定後馬上推播
+func getPassedDate(clock string, now time.Time) (date string, passed bool) {
+	now = now.In(utils.GetTaipeiLocation())
+	return now.Format("2006-01-02"), clock <= now.Format("15:04")
+}
+
+// Claim 標記今天的摘要已處理，回傳 false 代表已經有人處理過
+func (d *Digest) Claim(meta *models.Model, kind string, date string) (ok bool, err error) {
+	query := bson.M{"user_id": d.UserId, kind + "_sent": bson.M{"$ne": date}}
+	err = meta.CollectionDigest.Update(query, bson.M{"$set": bson.M{kind + "_sent": date}})
+	if err == mgo.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (d *Digest) upsert(meta *models.Model, update bson.M) (err error) {
+	query := bson.M{"user_id": d.UserId}
+	if _, err := meta.CollectionDigest.Upsert(query, update); err != nil {
+		meta.Log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// GetDueDigests 取出今天 clock 之前該送、但還沒送的摘要，時間字串固定為 "HH:MM" 所以可以直接比較
+func GetDueDigests(meta *models.Model, kind string, date string, clock string, weekday time.Weekday) (results []Digest, err error) {
+	query := bson.M{kind + "_time": bson.M{"$lte": clock}, kind + "_sent": bson.M{"$ne": date}}
+	if kind == DigestWeekly {
+		query["weekly_day"] = int(weekday)
+	}
+	if err := meta.CollectionDigest.Find(query).All(&results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (d *Delivery) Add(meta *models.Model) (err error) {
+	d.CreatedAt = time.Now()
+	if err := meta.CollectionDelivery.Insert(d); err != nil {
+		meta.Log.Println(err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mong0520/linebot-ptt-beauty/utils"
+)
+
+func TestGetPassedDate(t *testing.T) {
+	now := time.Date(2024, 1, 2, 21, 30, 0, 0, utils.GetTaipeiLocation())
+	tests := []struct {
+		name       string
+		clock      string
+		now        time.Time
+		wantDate   string
+		wantPassed bool
+	}{
+		{"earlier today", "08:00", now, "2024-01-02", true},
+		{"right now", "21:30", now, "2024-01-02", true},
+		{"later today", "22:00", now, "2024-01-02", false},
+		// 13:30 UTC 是台灣時間 21:30
+		{"utc time", "21:00", time.Date(2024, 1, 2, 13, 30, 0, 0, time.UTC), "2024-01-02", true},
+		// 20:00 UTC 已經是台灣時間隔天 04:00
+		{"next day in taipei", "08:00", time.Date(2024, 1, 2, 20, 0, 0, 0, time.UTC), "2024-01-03", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			date, passed := getPassedDate(tt.clock, tt.now)
+			if date != tt.wantDate || passed != tt.wantPassed {
+				t.Errorf("getPassedDate = %s, %t, want %s, %t", date, passed, tt.wantDate, tt.wantPassed)
+			}
+		})
+	}
+}
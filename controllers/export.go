@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/mong0520/linebot-ptt-beauty/models"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var ErrExportNotFound = errors.New("export link not found")
+
+// ExportLink 是匯出檔的下載連結，網址裡只有隨機的 token，使用者 id 留在伺服器端。
+// expires_at 有 TTL 索引，過期後由 MongoDB 刪除
+type ExportLink struct {
+	Token     string    `json:"token" bson:"_id"`
+	UserId    string    `json:"user_id" bson:"user_id"`
+	Format    string    `json:"format" bson:"format"`
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+// CreateExportLink 產生 ttl 內有效的下載連結
+func CreateExportLink(meta *models.Model, userId string, format string, ttl time.Duration) (link *ExportLink, err error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	link = &ExportLink{
+		Token:     base64.RawURLEncoding.EncodeToString(b),
+		UserId:    userId,
+		Format:    format,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := meta.CollectionExport.Insert(link); err != nil {
+		meta.Log.Println(err)
+		return nil, err
+	}
+	return link, nil
+}
+
+// GetExportLink 依 token 取出下載連結，找不到或已過期時回傳 ErrExportNotFound。
+// TTL 索引不會馬上刪掉過期的連結，所以這裡還要再檢查一次
+func GetExportLink(meta *models.Model, token string) (link *ExportLink, err error) {
+	if err := meta.CollectionExport.FindId(token).One(&link); err == mgo.ErrNotFound {
+		return nil, ErrExportNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if time.Now().After(link.ExpiresAt) {
+		return nil, ErrExportNotFound
+	}
+	return link, nil
+}
+
+// FavoriteExport 是匯出檔裡的一篇最愛，匯入時只用到 ArticleId、AddedAt、Note 與 Collection
+type FavoriteExport struct {
+	ArticleId  string    `json:"article_id"`
+	Title      string    `json:"title"`
+	URL        string    `json:"url"`
+	AddedAt    time.Time `json:"added_at"`
+	Note       string    `json:"note,omitempty"`
+	Collection string    `json:"collection,omitempty"`
+}
+
+// GetFavoriteExport 依加入順序取出使用者的最愛與文章標題、網址，文章已刪除時標題與網址為空
+func GetFavoriteExport(meta *models.Model, userId string) (results []FavoriteExport, err error) {
+	userFavorite := &UserFavorite{UserId: userId}
+	userData, err := userFavorite.Get(meta)
+	if err == mgo.ErrNotFound {
+		return []FavoriteExport{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	collections := map[string]string{}
+	for _, c := range userData.Collections {
+		for _, articleId := range c.Articles {
+			collections[articleId] = c.Name
+		}
+	}
+	documents := []models.ArticleDocument{}
+	query := bson.M{"article_id": bson.M{"$in": userData.FavoriteIds()}}
+	selector := bson.M{"article_id": 1, "article_title": 1, "url": 1}
+	if err := meta.Collection.Find(query).Select(selector).All(&documents); err != nil {
+		return nil, err
+	}
+	byId := map[string]models.ArticleDocument{}
+	for _, d := range documents {
+		byId[d.ArticleID] = d
+	}
+	results = []FavoriteExport{}
+	for _, f := range userData.Favorites {
+		results = append(results, FavoriteExport{
+			ArticleId:  f.ArticleId,
+			Title:      byId[f.ArticleId].ArticleTitle,
+			URL:        byId[f.ArticleId].URL,
+			AddedAt:    f.AddedAt,
+			Note:       f.Note,
+			Collection: collections[f.ArticleId],
+		})
+	}
+	return results, nil
+}
+
+// ImportResult 是匯入的結果：新加入、原本就在最愛裡，以及 ptt.beauty 找不到而略過的篇數
+type ImportResult struct {
+	Added   int
+	Existed int
+	Missing int
+}
+
+// ImportFavorites 依序加入最愛，保留原本的加入時間與備註，並放回同名的收藏夾 (沒有時建立，
+// 最多 maxCollections 個)。已經在最愛裡的只補上原本沒有的備註與收藏夾，ptt.beauty 找不到的文章略過
+func (u *UserFavorite) ImportFavorites(meta *models.Model, items []FavoriteExport, maxCollections int) (result ImportResult, err error) {
+	articleIds := []string{}
+	for _, item := range items {
+		articleIds = append(articleIds, item.ArticleId)
+	}
+	exists, err := getExistingArticleIds(meta, articleIds)
+	if err != nil {
+		meta.Log.Println(err)
+		return result, err
+	}
+	u.Add(meta)
+	userData, err := u.Get(meta)
+	if err != nil {
+		return result, err
+	}
+	for _, item := range items {
+		if !exists[item.ArticleId] {
+			result.Missing++
+			continue
+		}
+		added, err := u.importFavorite(meta, item)
+		if err != nil {
+			return result, err
+		}
+		if added {
+			result.Added++
+		} else {
+			result.Existed++
+		}
+		if item.Collection != "" && userData.getArticleCollection(item.ArticleId) == nil {
+			if err := userData.importToCollection(meta, item, maxCollections); err != nil {
+				return result, err
+			}
+		}
+	}
+	return result, nil
+}
+
+// importFavorite 加入一篇最愛，已經在最愛裡而且沒有備註時補上匯入的備註
+func (u *UserFavorite) importFavorite(meta *models.Model, item FavoriteExport) (added bool, err error) {
+	favorite := FavoriteItem{ArticleId: item.ArticleId, AddedAt: item.AddedAt, Note: item.Note}
+	if favorite.AddedAt.IsZero() {
+		favorite.AddedAt = time.Now()
+	}
+	query := bson.M{"user_id": u.UserId, "favorites.article_id": bson.M{"$ne": item.ArticleId}}
+	update := bson.M{"$push": bson.M{"favorites": favorite}}
+	if err := meta.CollectionUserFavorite.Update(query, update); err == nil {
+		return true, nil
+	} else if err != mgo.ErrNotFound {
+		meta.Log.Println(err)
+		return false, err
+	}
+	if item.Note == "" {
+		return false, nil
+	}
+	// 備註是 omitempty，沒有備註的最愛不會有 note 欄位
+	query = bson.M{"user_id": u.UserId, "favorites": bson.M{"$elemMatch": bson.M{"article_id": item.ArticleId, "note": bson.M{"$exists": false}}}}
+	update = bson.M{"$set": bson.M{"favorites.$.note": item.Note}}
+	if err := meta.CollectionUserFavorite.Update(query, update); err != nil && err != mgo.ErrNotFound {
+		meta.Log.Println(err)
+		return false, err
+	}
+	return false, nil
+}
+
+// importToCollection 把文章放進同名的收藏夾，收藏夾不存在時建立，超過上限時留在未分類
+func (u *UserFavorite) importToCollection(meta *models.Model, item FavoriteExport, maxCollections int) (err error) {
+	collection := u.GetCollectionByName(item.Collection)
+	if collection == nil {
+		if len(u.Collections) >= maxCollections {
+			return nil
+		}
+		created, err := u.CreateCollection(meta, item.Collection)
+		if err == ErrCollectionExists {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		u.Collections = append(u.Collections, *created)
+		collection = &u.Collections[len(u.Collections)-1]
+	}
+	query := bson.M{"user_id": u.UserId, "collections.id": collection.Id}
+	update := bson.M{"$addToSet": bson.M{"collections.$.articles": item.ArticleId}}
+	if err := meta.CollectionUserFavorite.Update(query, update); err != nil && err != mgo.ErrNotFound {
+		meta.Log.Println(err)
+		return err
+	}
+	collection.Articles = append(collection.Articles, item.ArticleId)
+	return nil
+}
+
+// getArticleCollection 找出文章所在的收藏夾，未分類時回傳 nil
+func (u *UserFavorite) getArticleCollection(articleId string) *FavoriteCollection {
+	for idx := range u.Collections {
+		for _, id := range u.Collections[idx].Articles {
+			if id == articleId {
+				return &u.Collections[idx]
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/mong0520/linebot-ptt-beauty/models"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// 最愛的排序方式
+const (
+	FavoriteSortAdded string = "added"
+	FavoriteSortPush  string = "push"
+	FavoriteSortDate  string = "date"
+)
+
+// FavoriteItem 是一篇最愛，舊資料只有文章 id，AddedAt 會是零值
+type FavoriteItem struct {
+	ArticleId string    `json:"article_id" bson:"article_id"`
+	AddedAt   time.Time `json:"added_at" bson:"added_at,omitempty"`
+	Note      string    `json:"note" bson:"note,omitempty"`
+}
+
+// SetBSON 相容舊資料：最愛原本只存文章 id 字串
+func (f *FavoriteItem) SetBSON(raw bson.Raw) error {
+	if raw.Kind == 0x02 {
+		return raw.Unmarshal(&f.ArticleId)
+	}
+	type item FavoriteItem
+	return raw.Unmarshal((*item)(f))
+}
+
+// FavoriteIds 依加入順序回傳最愛的文章 id
+func (u *UserFavorite) FavoriteIds() (articleIds []string) {
+	articleIds = []string{}
+	for _, f := range u.Favorites {
+		articleIds = append(articleIds, f.ArticleId)
+	}
+	return articleIds
+}
+
+// LatestFavorite 回傳最後加入的最愛，沒有最愛時回傳 nil
+func (u *UserFavorite) LatestFavorite() *FavoriteItem {
+	if len(u.Favorites) == 0 {
+		return nil
+	}
+	return &u.Favorites[len(u.Favorites)-1]
+}
+
+// SetNote 設定最愛的備註，note 為空時刪除
+func (u *UserFavorite) SetNote(meta *models.Model, articleId string, note string) (err error) {
+	query := bson.M{"user_id": u.UserId, "favorites.article_id": articleId}
+	update := bson.M{"$set": bson.M{"favorites.$.note": note}}
+	if note == "" {
+		update = bson.M{"$unset": bson.M{"favorites.$.note": ""}}
+	}
+	if err := meta.CollectionUserFavorite.Update(query, update); err != nil {
+		meta.Log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// MigrateFavorites 把舊格式的最愛 (文章 id 字串) 轉成 FavoriteItem。
+// 讀取時 SetBSON 已經相容，但資料庫端的查詢與更新需要統一的格式
+func MigrateFavorites(meta *models.Model) (err error) {
+	// $type 2 是字串，陣列裡有任何一個字串就會符合
+	query := bson.M{"favorites": bson.M{"$type": 2}}
+	iter := meta.CollectionUserFavorite.Find(query).Iter()
+	record := UserFavorite{}
+	count := 0
+	for iter.Next(&record) {
+		update := bson.M{"$set": bson.M{"favorites": record.Favorites}}
+		if err := meta.CollectionUserFavorite.Update(bson.M{"user_id": record.UserId}, update); err != nil {
+			iter.Close()
+			return err
+		}
+		count++
+		record = UserFavorite{}
+	}
+	if count > 0 {
+		meta.Log.Printf("Migrate favorites of %d users\n", count)
+	}
+	return iter.Close()
+}
+
+// GetFavoriteArticles 依排序方式取出一頁最愛的文章，articleIds 需依加入順序排列。
+// 依加入時間排序時新的在前；依推文數或文章日期排序時由資料庫排序，找不到的文章排在最後 (新加入的在前)。
+// 找不到的文章只填 ArticleID (ID 為空)，讓呼叫端顯示已刪除
+func GetFavoriteArticles(collection *mgo.Collection, articleIds []string, sortBy string, page int, perPage int) (results []models.ArticleDocument, lastPage bool, err error) {
+	results = []models.ArticleDocument{}
+	if sortBy == FavoriteSortPush || sortBy == FavoriteSortDate {
+		sort := "-message_count.push"
+		if sortBy == FavoriteSortDate {
+			sort = "-timestamp"
+		}
+		query := bson.M{"article_id": bson.M{"$in": articleIds}}
+		documents := []models.ArticleDocument{}
+		if err := collection.Find(query).Select(bson.M{"article_id": 1}).All(&documents); err != nil {
+			return nil, false, err
+		}
+		exists := map[string]bool{}
+		for _, d := range documents {
+			exists[d.ArticleID] = true
+		}
+		missingIds := []string{}
+		for i := len(articleIds) - 1; i >= 0; i-- {
+			if !exists[articleIds[i]] {
+				missingIds = append(missingIds, articleIds[i])
+			}
+		}
+		if page*perPage < len(documents) {
+			if err := collection.Find(query).Sort(sort).Skip(page * perPage).Limit(perPage).All(&results); err != nil {
+				return nil, false, err
+			}
+		}
+		pageIds, last := getMissingPage(missingIds, len(documents), page, perPage)
+		for _, articleId := range pageIds {
+			results = append(results, models.ArticleDocument{ArticleID: articleId})
+		}
+		return results, last, nil
+	}
+
+	startIdx := len(articleIds) - page*perPage
+	endIdx := startIdx - perPage
+	lastPage = endIdx <= 0
+	if endIdx < 0 {
+		endIdx = 0
+	}
+	if startIdx < 0 {
+		startIdx = 0
+	}
+	pageIds := []string{}
+	for i := startIdx - 1; i >= endIdx; i-- {
+		pageIds = append(pageIds, articleIds[i])
+	}
+	documents := []models.ArticleDocument{}
+	if err := collection.Find(bson.M{"article_id": bson.M{"$in": pageIds}}).All(&documents); err != nil {
+		return nil, false, err
+	}
+	byId := map[string]models.ArticleDocument{}
+	for _, d := range documents {
+		byId[d.ArticleID] = d
+	}
+	for _, articleId := range pageIds {
+		if d, ok := byId[articleId]; ok {
+			results = append(results, d)
+		} else {
+			results = append(results, models.ArticleDocument{ArticleID: articleId})
+		}
+	}
+	return results, lastPage, nil
+}
+
+// getMissingPage 找不到的文章接在 existingCount 篇找得到的文章之後分頁，回傳這一頁要補上的文章 id
+func getMissingPage(missingIds []string, existingCount int, page int, perPage int) (pageIds []string, lastPage bool) {
+	startIdx := page*perPage - existingCount
+	endIdx := startIdx + perPage
+	lastPage = endIdx >= len(missingIds)
+	if startIdx < 0 {
+		startIdx = 0
+	}
+	if endIdx > len(missingIds) {
+		endIdx = len(missingIds)
+	}
+	if startIdx >= endIdx {
+		return []string{}, lastPage
+	}
+	return missingIds[startIdx:endIdx], lastPage
+}
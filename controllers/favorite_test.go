@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestFavoriteItemSetBSON(t *testing.T) {
+	addedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name      string
+		favorites []interface{}
+		want      []FavoriteItem
+	}{
+		{"legacy article ids", []interface{}{"M.1.A.1", "M.2.A.2"},
+			[]FavoriteItem{{ArticleId: "M.1.A.1"}, {ArticleId: "M.2.A.2"}}},
+		{"new items", []interface{}{bson.M{"article_id": "M.1.A.1", "added_at": addedAt, "note": "備註"}},
+			[]FavoriteItem{{ArticleId: "M.1.A.1", AddedAt: addedAt, Note: "備註"}}},
+		{"mixed during migration", []interface{}{"M.1.A.1", bson.M{"article_id": "M.2.A.2", "added_at": addedAt}},
+			[]FavoriteItem{{ArticleId: "M.1.A.1"}, {ArticleId: "M.2.A.2", AddedAt: addedAt}}},
+		{"empty", []interface{}{}, []FavoriteItem{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := bson.Marshal(bson.M{"user_id": "U1", "favorites": tt.favorites})
+			if err != nil {
+				t.Fatal(err)
+			}
+			record := &UserFavorite{}
+			if err := bson.Unmarshal(data, record); err != nil {
+				t.Fatal(err)
+			}
+			for idx := range record.Favorites {
+				// bson 的時間只到毫秒並轉成本地時區，比較前統一
+				if !record.Favorites[idx].AddedAt.IsZero() {
+					record.Favorites[idx].AddedAt = record.Favorites[idx].AddedAt.UTC()
+				}
+			}
+			if !reflect.DeepEqual(record.Favorites, tt.want) {
+				t.Errorf("favorites = %+v, want %+v", record.Favorites, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMissingPage(t *testing.T) {
+	missingIds := []string{"M.3.A.3", "M.2.A.2", "M.1.A.1"}
+	tests := []struct {
+		name          string
+		missingIds    []string
+		existingCount int
+		page          int
+		want          []string
+		wantLastPage  bool
+	}{
+		{"page full of existing articles", missingIds, 5, 0, []string{}, false},
+		{"missing after existing on the same page", missingIds, 3, 0, []string{"M.3.A.3"}, false},
+		{"rest of missing on the next page", missingIds, 3, 1, []string{"M.2.A.2", "M.1.A.1"}, true},
+		{"only missing articles", missingIds, 0, 0, []string{"M.3.A.3", "M.2.A.2", "M.1.A.1"}, true},
+		{"nothing missing", []string{}, 4, 0, []string{}, true},
+		{"nothing missing with more pages", []string{}, 5, 0, []string{}, false},
+		{"past the end", missingIds, 0, 2, []string{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, lastPage := getMissingPage(tt.missingIds, tt.existingCount, tt.page, 4)
+			if !reflect.DeepEqual(got, tt.want) || lastPage != tt.wantLastPage {
+				t.Errorf("getMissingPage = %v, %t, want %v, %t", got, lastPage, tt.want, tt.wantLastPage)
+			}
+		})
+	}
+}
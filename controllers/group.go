@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/mong0520/linebot-ptt-beauty/models"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// GroupFavorite 是群組共用的最愛，記錄是誰加入的
+type GroupFavorite struct {
+	ArticleId string    `json:"article_id" bson:"article_id"`
+	UserId    string    `json:"user_id" bson:"user_id"`
+	AddedAt   time.Time `json:"added_at" bson:"added_at,omitempty"`
+}
+
+// Group 是群組或多人聊天室的設定，GroupId 是 Line 的 groupId 或 roomId
+type Group struct {
+	GroupId string `json:"group_id" bson:"group_id"`
+	// Disabled 預設為 false，新加入的群組不用另外建立記錄就能使用
+	Disabled   bool            `json:"disabled" bson:"disabled"`
+	Categories []string        `json:"categories" bson:"categories"`
+	Favorites  []GroupFavorite `json:"favorites" bson:"favorites"`
+	// Left 表示機器人已離開群組，重新被邀請時會清掉
+	Left     bool      `json:"left" bson:"left,omitempty"`
+	JoinedAt time.Time `json:"joined_at" bson:"joined_at,omitempty"`
+	LeftAt   time.Time `json:"left_at" bson:"left_at,omitempty"`
+	// UpdatedBy 是最後修改開關或分類的成員 user id
+	UpdatedBy string    `json:"updated_by" bson:"updated_by,omitempty"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at,omitempty"`
+}
+
+// Get 取出群組設定，還沒有記錄時回傳預設值
+func (g *Group) Get(meta *models.Model) (result *Group, err error) {
+	query := bson.M{"group_id": g.GroupId}
+	if err := meta.CollectionGroup.Find(query).One(&result); err == mgo.ErrNotFound {
+		return &Group{GroupId: g.GroupId}, nil
+	} else if err != nil {
+		meta.Log.Println(err)
+		return nil, err
+	}
+	return result, nil
+}
+
+// Join 機器人被邀請進群組時呼叫，保留之前的設定與最愛
+func (g *Group) Join(meta *models.Model) (err error) {
+	return g.upsert(meta, bson.M{"$set": bson.M{"left": false, "joined_at": time.Now()}})
+}
+
+func (g *Group) Leave(meta *models.Model) (err error) {
+	return g.upsert(meta, bson.M{"$set": bson.M{"left": true, "left_at": time.Now()}})
+}
+
+// SetDisabled 開啟或關閉群組，並記錄是哪個成員改的
+func (g *Group) SetDisabled(meta *models.Model, disabled bool, userId string) (err error) {
+	return g.upsert(meta, bson.M{"$set": bson.M{"disabled": disabled, "updated_by": userId, "updated_at": time.Now()}})
+}
+
+// SetCategories 設定群組允許的分類，空的代表不限制，並記錄是哪個成員改的
+func (g *Group) SetCategories(meta *models.Model, categories []string, userId string) (err error) {
+	return g.upsert(meta, bson.M{"$set": bson.M{"categories": categories, "updated_by": userId, "updated_at": time.Now()}})
+}
+
+// AddFavorite 以 userId 的名義加入群組最愛，回傳 false 代表原本就在最愛裡
+func (g *Group) AddFavorite(meta *models.Model, articleId string, userId string) (added bool, err error) {
+	if err := g.upsert(meta, bson.M{"$setOnInsert": bson.M{"favorites": []GroupFavorite{}}}); err != nil {
+		return false, err
+	}
+	query := bson.M{"group_id": g.GroupId, "favorites.article_id": bson.M{"$ne": articleId}}
+	favorite := GroupFavorite{ArticleId: articleId, UserId: userId, AddedAt: time.Now()}
+	if err := meta.CollectionGroup.Update(query, bson.M{"$push": bson.M{"favorites": favorite}}); err == mgo.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		meta.Log.Println(err)
+		return false, err
+	}
+	return true, nil
+}
+
+// RemoveFavorite 移除群組最愛，回傳 false 代表原本就不在最愛裡
+func (g *Group) RemoveFavorite(meta *models.Model, articleId string) (removed bool, err error) {
+	query := bson.M{"group_id": g.GroupId, "favorites.article_id": articleId}
+	update := bson.M{"$pull": bson.M{"favorites": bson.M{"article_id": articleId}}}
+	if err := meta.CollectionGroup.Update(query, update); err == mgo.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		meta.Log.Println(err)
+		return false, err
+	}
+	return true, nil
+}
+
+// FavoriteIds 回傳群組最愛的文章，依加入順序排列
+func (g *Group) FavoriteIds() (articleIds []string) {
+	articleIds = []string{}
+	for _, f := range g.Favorites {
+		articleIds = append(articleIds, f.ArticleId)
+	}
+	return articleIds
+}
+
+func (g *Group) upsert(meta *models.Model, update bson.M) (err error) {
+	query := bson.M{"group_id": g.GroupId}
+	if _, err := meta.CollectionGroup.Upsert(query, update); err != nil {
+		meta.Log.Println(err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/mong0520/linebot-ptt-beauty/models"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// JobState 記錄背景工作處理到哪裡，重新啟動後可以接著做
+type JobState struct {
+	Name      string        `json:"name" bson:"_id"`
+	Cursor    bson.ObjectId `json:"cursor" bson:"cursor,omitempty"`
+	UpdatedAt time.Time     `json:"updated_at" bson:"updated_at"`
+}
+
+// GetJobState 取出背景工作的進度，第一次執行時回傳 nil
+func GetJobState(meta *models.Model, name string) (state *JobState, err error) {
+	if err := meta.CollectionJob.FindId(name).One(&state); err == mgo.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func (j *JobState) Save(meta *models.Model) (err error) {
+	j.UpdatedAt = time.Now()
+	if _, err := meta.CollectionJob.UpsertId(j.Name, j); err != nil {
+		meta.Log.Println(err)
+		return err
+	}
+	return nil
+}
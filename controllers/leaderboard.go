@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mong0520/linebot-ptt-beauty/models"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type FavoriteCount struct {
+	ArticleID string `json:"article_id" bson:"_id"`
+	Count     int    `json:"count" bson:"count"`
+}
+
+type AuthorRank struct {
+	Author     string                 `json:"author" bson:"_id"`
+	Push       int                    `json:"push" bson:"push"`
+	Articles   int                    `json:"articles" bson:"articles"`
+	TopArticle models.ArticleDocument `json:"top_article" bson:"-"`
+}
+
+type Leaderboard struct {
+	WeeklyFavorites []models.ArticleDocument
+	AllFavorites    []models.ArticleDocument
+	FavoriteCounts  map[string]int
+	// WeeklyFavoriteCounts 是最近 7 天內加入最愛的次數
+	WeeklyFavoriteCounts map[string]int
+	TopAuthors           []AuthorRank
+	UpdatedAt            time.Time
+}
+
+var leaderboard = &Leaderboard{FavoriteCounts: map[string]int{}, WeeklyFavoriteCounts: map[string]int{}}
+var leaderboardLock sync.RWMutex
+
+// GetLeaderboard 回傳最近一次計算好的排行榜
+func GetLeaderboard() (result Leaderboard) {
+	leaderboardLock.RLock()
+	defer leaderboardLock.RUnlock()
+	return *leaderboard
+}
+
+// RefreshLeaderboard 重新計算最愛排行與作者排行，並更新快取
+func RefreshLeaderboard(meta *models.Model, count int) (err error) {
+	allFavorites, favoriteCounts, err := getFavoriteRanking(meta, time.Time{}, count)
+	if err != nil {
+		return err
+	}
+	// 本週最愛依最近 7 天加入最愛的時間計算，和文章發表的時間無關
+	weekAgo := time.Now().Add(-7 * 24 * time.Hour)
+	weeklyFavorites, weeklyCounts, err := getFavoriteRanking(meta, weekAgo, count)
+	if err != nil {
+		return err
+	}
+
+	// 快取的作者排行用預設的分類，改過分類或開啟安全模式的使用者另外查詢
+	authors, err := GetTopAuthors(meta.Collection, count, ArticleFilter{})
+	if err != nil {
+		return err
+	}
+
+	leaderboardLock.Lock()
+	defer leaderboardLock.Unlock()
+	leaderboard = &Leaderboard{
+		WeeklyFavorites:      weeklyFavorites,
+		AllFavorites:         allFavorites,
+		FavoriteCounts:       favoriteCounts,
+		WeeklyFavoriteCounts: weeklyCounts,
+		TopAuthors:           authors,
+		UpdatedAt:            time.Now(),
+	}
+	return nil
+}
+
+// getFavoriteRanking 取出被加入最愛最多次的前幾篇文章，since 不是零值時只算這之後加入的最愛
+func getFavoriteRanking(meta *models.Model, since time.Time, count int) (records []models.ArticleDocument, favoriteCounts map[string]int, err error) {
+	counts, err := getFavoriteCounts(meta.CollectionUserFavorite, since)
+	if err != nil {
+		return nil, nil, err
+	}
+	favoriteCounts = map[string]int{}
+	articleIds := []string{}
+	for _, c := range counts {
+		favoriteCounts[c.ArticleID] = c.Count
+		articleIds = append(articleIds, c.ArticleID)
+	}
+	if len(articleIds) > count {
+		articleIds = articleIds[:count]
+	}
+	records = []models.ArticleDocument{}
+	if err := meta.Collection.Find(bson.M{"article_id": bson.M{"$in": articleIds}}).All(&records); err != nil {
+		return nil, nil, err
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return favoriteCounts[records[i].ArticleID] > favoriteCounts[records[j].ArticleID]
+	})
+	return records, favoriteCounts, nil
+}
+
+// getFavoriteCounts 統計每篇文章被多少使用者加入最愛，由多到少排序，since 不是零值時只算這之後加入的
+func getFavoriteCounts(collection *mgo.Collection, since time.Time) (results []FavoriteCount, err error) {
+	pipeline := []bson.M{{"$unwind": "$favorites"}}
+	if !since.IsZero() {
+		pipeline = append(pipeline, bson.M{"$match": bson.M{"favorites.added_at": bson.M{"$gte": since}}})
+	}
+	pipeline = append(pipeline,
+		bson.M{"$group": bson.M{"_id": "$favorites.article_id", "count": bson.M{"$sum": 1}}},
+		bson.M{"$sort": bson.M{"count": -1}},
+	)
+	if err := collection.Pipe(pipeline).All(&results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// GetTopAuthors 依總推文數取出符合條件的前幾名作者，以及各自推文最多的文章
+func GetTopAuthors(collection *mgo.Collection, count int, filter ArticleFilter) (results []AuthorRank, err error) {
+	pipeline := []bson.M{
+		{"$match": bson.M{"article_title": bson.M{"$regex": filter.titleRegex("")}}},
+		{"$group": bson.M{
+			"_id":      "$author",
+			"push":     bson.M{"$sum": "$message_count.push"},
+			"articles": bson.M{"$sum": 1},
+		}},
+		{"$sort": bson.M{"push": -1}},
+		{"$limit": count},
+	}
+	if err := collection.Pipe(pipeline).All(&results); err != nil {
+		return nil, err
+	}
+	for i := range results {
+		if top, err := GetByAuthor(collection, results[i].Author, 1, filter); err == nil && len(top) > 0 {
+			results[i].TopArticle = top[0]
+		}
+	}
+	return results, nil
+}
+
+// GetByAuthor 取出作者符合條件的文章中推文數最多的幾篇
+func GetByAuthor(collection *mgo.Collection, author string, count int, filter ArticleFilter) (results []models.ArticleDocument, err error) {
+	document := &models.ArticleDocument{}
+	query := bson.M{"author": author, "article_title": bson.M{"$regex": filter.titleRegex("")}}
+	results, err = document.GeneralQueryAll(collection, query, "-message_count.push", count)
+	if err != nil {
+		return nil, err
+	} else {
+		return results, nil
+	}
+}
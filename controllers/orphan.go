@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/mong0520/linebot-ptt-beauty/models"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// 一次用 $in 查詢的文章數
+const orphanBatchSize = 500
+
+// OrphanFavorite 是被加入最愛、但已經不在 ptt.beauty 的文章
+type OrphanFavorite struct {
+	ArticleId string    `json:"article_id" bson:"_id"`
+	FirstSeen time.Time `json:"first_seen" bson:"first_seen"`
+}
+
+// FindOrphanFavorites 找出使用者與群組最愛裡，已經不在 ptt.beauty 的文章，
+// favoriteCount 是最愛裡不重複的文章數
+func FindOrphanFavorites(meta *models.Model) (articleIds []string, favoriteCount int, err error) {
+	favoriteIds := []string{}
+	for _, collection := range []*mgo.Collection{meta.CollectionUserFavorite, meta.CollectionGroup} {
+		ids, err := getDistinctFavoriteIds(collection)
+		if err != nil {
+			return nil, 0, err
+		}
+		favoriteIds = append(favoriteIds, ids...)
+	}
+
+	exists, err := getExistingArticleIds(meta, favoriteIds)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	articleIds = []string{}
+	seen := map[string]bool{}
+	for _, articleId := range favoriteIds {
+		if seen[articleId] {
+			continue
+		}
+		seen[articleId] = true
+		if !exists[articleId] {
+			articleIds = append(articleIds, articleId)
+		}
+	}
+	return articleIds, len(seen), nil
+}
+
+// CountArticles 回傳 ptt.beauty 的文章數
+func CountArticles(meta *models.Model) (count int, err error) {
+	return meta.Collection.Count()
+}
+
+// getExistingArticleIds 分批查詢哪些文章還在 ptt.beauty
+func getExistingArticleIds(meta *models.Model, articleIds []string) (exists map[string]bool, err error) {
+	exists = map[string]bool{}
+	for start := 0; start < len(articleIds); start += orphanBatchSize {
+		end := start + orphanBatchSize
+		if end > len(articleIds) {
+			end = len(articleIds)
+		}
+		documents := []models.ArticleDocument{}
+		query := bson.M{"article_id": bson.M{"$in": articleIds[start:end]}}
+		if err := meta.Collection.Find(query).Select(bson.M{"article_id": 1}).All(&documents); err != nil {
+			return nil, err
+		}
+		for _, d := range documents {
+			exists[d.ArticleID] = true
+		}
+	}
+	return exists, nil
+}
+
+func getDistinctFavoriteIds(collection *mgo.Collection) (articleIds []string, err error) {
+	pipeline := []bson.M{
+		{"$unwind": "$favorites"},
+		{"$group": bson.M{"_id": "$favorites.article_id"}},
+	}
+	results := []struct {
+		ArticleId string `bson:"_id"`
+	}{}
+	if err := collection.Pipe(pipeline).All(&results); err != nil {
+		return nil, err
+	}
+	for _, r := range results {
+		articleIds = append(articleIds, r.ArticleId)
+	}
+	return articleIds, nil
+}
+
+// MarkOrphanFavorites 記錄這次找到的孤兒最愛，已經記錄過的保留第一次發現的時間；
+// 文章重新出現 (例如爬蟲補抓) 時移除記錄
+func MarkOrphanFavorites(meta *models.Model, articleIds []string, now time.Time) (err error) {
+	for _, articleId := range articleIds {
+		update := bson.M{"$setOnInsert": bson.M{"first_seen": now}}
+		if _, err := meta.CollectionOrphan.UpsertId(articleId, update); err != nil {
+			meta.Log.Println(err)
+			return err
+		}
+	}
+	if _, err := meta.CollectionOrphan.RemoveAll(bson.M{"_id": bson.M{"$nin": articleIds}}); err != nil {
+		meta.Log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// GetExpiredOrphans 取出在 before 之前就已經找不到的文章
+func GetExpiredOrphans(meta *models.Model, before time.Time) (articleIds []string, err error) {
+	orphans := []OrphanFavorite{}
+	if err := meta.CollectionOrphan.Find(bson.M{"first_seen": bson.M{"$lte": before}}).All(&orphans); err != nil {
+		return nil, err
+	}
+	articleIds = []string{}
+	for _, o := range orphans {
+		articleIds = append(articleIds, o.ArticleId)
+	}
+	return articleIds, nil
+}
+
+// PruneFavorites 從所有使用者 (含收藏夾) 與群組的最愛移除這些文章，回傳受影響的筆數
+func PruneFavorites(meta *models.Model, articleIds []string) (users int, groups int, err error) {
+	if len(articleIds) == 0 {
+		return 0, 0, nil
+	}
+	in := bson.M{"$in": articleIds}
+	userInfo, err := meta.CollectionUserFavorite.UpdateAll(bson.M{"favorites.article_id": in},
+		bson.M{"$pull": bson.M{"favorites": bson.M{"article_id": in}}})
+	if err != nil {
+		meta.Log.Println(err)
+		return 0, 0, err
+	}
+	if _, err := meta.CollectionUserFavorite.UpdateAll(bson.M{"collections.articles": in},
+		bson.M{"$pull": bson.M{"collections.$[].articles": in}}); err != nil {
+		meta.Log.Println(err)
+		return userInfo.Updated, 0, err
+	}
+	groupInfo, err := meta.CollectionGroup.UpdateAll(bson.M{"favorites.article_id": in},
+		bson.M{"$pull": bson.M{"favorites": bson.M{"article_id": in}}})
+	if err != nil {
+		meta.Log.Println(err)
+		return userInfo.Updated, 0, err
+	}
+	if _, err := meta.CollectionOrphan.RemoveAll(bson.M{"_id": in}); err != nil {
+		meta.Log.Println(err)
+		return userInfo.Updated, groupInfo.Updated, err
+	}
+	return userInfo.Updated, groupInfo.Updated, nil
+}
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/mong0520/linebot-ptt-beauty/models"
+	"github.com/mong0520/linebot-ptt-beauty/utils"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// GetOrEmpty 和 Get 一樣，但沒有記錄時回傳空的最愛，不會建立記錄
+func (u *UserFavorite) GetOrEmpty(meta *models.Model) (result *UserFavorite, err error) {
+	if err := meta.CollectionUserFavorite.Find(bson.M{"user_id": u.UserId}).One(&result); err == mgo.ErrNotFound {
+		return &UserFavorite{UserId: u.UserId, Favorites: []FavoriteItem{}}, nil
+	} else if err != nil {
+		meta.Log.Println(err)
+		return nil, err
+	}
+	return result, nil
+}
+
+// DeleteUserData 刪除使用者的最愛、收藏夾與分享、訂閱、摘要、推播記錄與匯出連結。
+// 群組最愛與設定屬於群組所以保留，只清掉是誰加入或修改的；管理指令的稽核記錄保留，但 user id 換成代號
+func DeleteUserData(meta *models.Model, userId string) (err error) {
+	query := bson.M{"user_id": userId}
+	for _, collection := range []*mgo.Collection{
+		meta.CollectionUserFavorite,
+		meta.CollectionSubscription,
+		meta.CollectionDigest,
+		meta.CollectionDelivery,
+		meta.CollectionShare,
+		meta.CollectionSettings,
+		meta.CollectionExport,
+	} {
+		if _, err := collection.RemoveAll(query); err != nil {
+			meta.Log.Println(err)
+			return err
+		}
+	}
+	if _, err := meta.CollectionAudit.UpdateAll(query, bson.M{"$set": bson.M{"user_id": utils.RedactID(userId)}}); err != nil {
+		meta.Log.Println(err)
+		return err
+	}
+	if _, err := meta.CollectionGroup.UpdateAll(bson.M{"updated_by": userId}, bson.M{"$unset": bson.M{"updated_by": ""}}); err != nil {
+		meta.Log.Println(err)
+		return err
+	}
+	// 位置運算子一次只改一筆，同一個群組裡有多篇時要重複執行
+	for {
+		info, err := meta.CollectionGroup.UpdateAll(bson.M{"favorites.user_id": userId},
+			bson.M{"$set": bson.M{"favorites.$.user_id": ""}})
+		if err != nil {
+			meta.Log.Println(err)
+			return err
+		}
+		if info.Updated == 0 {
+			break
+		}
+	}
+	return nil
+}
+
+// GetExpiredUserIds 取出在 before 之前就封鎖機器人的使用者
+func GetExpiredUserIds(meta *models.Model, before time.Time) (userIds []string, err error) {
+	query := bson.M{"inactive": true, "unfollowed_at": bson.M{"$lte": before}}
+	if err := meta.CollectionUserFavorite.Find(query).Distinct("user_id", &userIds); err != nil {
+		return nil, err
+	}
+	return userIds, nil
+}
+
+// PurgeDeliveries 刪除 before 之前的推播記錄，回傳刪除的筆數
+func PurgeDeliveries(meta *models.Model, before time.Time) (count int, err error) {
+	info, err := meta.CollectionDelivery.RemoveAll(bson.M{"created_at": bson.M{"$lt": before}})
+	if err != nil {
+		meta.Log.Println(err)
+		return 0, err
+	}
+	return info.Removed, nil
+}
@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/mong0520/linebot-ptt-beauty/models"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Settings 的欄位名稱，也是 postback 裡指定要改哪個設定用的
+const (
+	SettingCategories string = "categories"
+	SettingPageSize   string = "page_size"
+	SettingOrder      string = "order"
+	SettingNoDigest   string = "no_digest"
+	SettingLanguage   string = "language"
+	SettingSafeMode   string = "safe_mode"
+)
+
+// 查詢結果的排序，空字串代表各功能原本的排序
+const (
+	OrderDefault string = ""
+	OrderPush    string = FavoriteSortPush
+	OrderDate    string = FavoriteSortDate
+)
+
+// 介面語言，空字串代表預設的繁體中文
+const (
+	LanguageZhTW string = "zh-TW"
+	LanguageEn   string = "en"
+	LanguageJa   string = "ja"
+)
+
+// Settings 是使用者的個人設定，零值代表使用預設值，所以沒有設定過的使用者不需要記錄
+type Settings struct {
+	UserId     string   `json:"user_id" bson:"user_id"`
+	Categories []string `json:"categories" bson:"categories,omitempty"`
+	// PageSize 是每次送出的文章數，0 代表各功能的預設值
+	PageSize int    `json:"page_size" bson:"page_size,omitempty"`
+	Order    string `json:"order" bson:"order,omitempty"`
+	// NoDigest 暫停熱門摘要推播，但保留原本設定的時間
+	NoDigest bool   `json:"no_digest" bson:"no_digest,omitempty"`
+	Language string `json:"language" bson:"language,omitempty"`
+	// SafeMode 排除標題有限制級字眼的文章
+	SafeMode bool `json:"safe_mode" bson:"safe_mode,omitempty"`
+}
+
+// ArticleFilter 是查詢文章時共用的條件，Categories 為空時只查正妹
+type ArticleFilter struct {
+	Categories []string
+	SafeMode   bool
+}
+
+// 安全模式排除的標題字眼，同時用在資料庫查詢與程式裡的比對
+var unsafeTitlePattern = "18禁|限制級|露點|NSFW|nsfw|🔞"
+var unsafeTitleRegexp = regexp.MustCompile(unsafeTitlePattern)
+
+func (f ArticleFilter) safePrefix() string {
+	if !f.SafeMode {
+		return ""
+	}
+	return fmt.Sprintf("(?!.*(?:%s))", unsafeTitlePattern)
+}
+
+// IsDefault 判斷是否和沒有設定時的條件相同
+func (f ArticleFilter) IsDefault() bool {
+	return len(f.Categories) == 0 && !f.SafeMode
+}
+
+// Allow 判斷查詢以外取得的文章 (例如新文章通知) 是否符合安全模式
+func (f ArticleFilter) Allow(article models.ArticleDocument) bool {
+	return !f.SafeMode || !unsafeTitleRegexp.MatchString(article.ArticleTitle)
+}
+
+// Filter 依設定產生查詢條件
+func (s *Settings) Filter() ArticleFilter {
+	return ArticleFilter{Categories: s.Categories, SafeMode: s.SafeMode}
+}
+
+// GetSettings 取出使用者的設定，沒有設定過時回傳預設值
+func GetSettings(meta *models.Model, userId string) (settings *Settings, err error) {
+	if err := meta.CollectionSettings.Find(bson.M{"user_id": userId}).One(&settings); err == mgo.ErrNotFound {
+		return &Settings{UserId: userId}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// GetAllSettings 取出有設定過的使用者，以 user_id 對應，給推播依各自的設定查詢
+func GetAllSettings(meta *models.Model) (results map[string]*Settings, err error) {
+	settings := []Settings{}
+	if err := meta.CollectionSettings.Find(nil).All(&settings); err != nil {
+		return nil, err
+	}
+	results = map[string]*Settings{}
+	for idx := range settings {
+		results[settings[idx].UserId] = &settings[idx]
+	}
+	return results, nil
+}
+
+// Set 修改一個設定，value 是零值時刪除該欄位回到預設值
+func (s *Settings) Set(meta *models.Model, field string, value interface{}) (err error) {
+	update := bson.M{"$set": bson.M{field: value}}
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			update = bson.M{"$unset": bson.M{field: ""}}
+		}
+	case int:
+		if v == 0 {
+			update = bson.M{"$unset": bson.M{field: ""}}
+		}
+	case bool:
+		if !v {
+			update = bson.M{"$unset": bson.M{field: ""}}
+		}
+	case []string:
+		if len(v) == 0 {
+			update = bson.M{"$unset": bson.M{field: ""}}
+		}
+	}
+	if _, err := meta.CollectionSettings.Upsert(bson.M{"user_id": s.UserId}, update); err != nil {
+		meta.Log.Println(err)
+		return err
+	}
+	return nil
+}
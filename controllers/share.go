@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/mong0520/linebot-ptt-beauty/models"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// 分享碼去掉容易看錯的 0/O、1/I/L
+const shareCodeAlphabet = "23456789ABCDEFGHJKMNPQRSTUVWXYZ"
+const shareCodeLength = 6
+
+var ErrShareNotFound = errors.New("share not found")
+
+// Share 是收藏夾的分享碼，看到的是擁有者目前的收藏夾，不是建立當下的快照。
+// CollectionId 為空代表分享全部最愛
+type Share struct {
+	Code         string    `json:"code" bson:"_id"`
+	UserId       string    `json:"user_id" bson:"user_id"`
+	CollectionId string    `json:"collection_id" bson:"collection_id"`
+	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
+}
+
+func newShareCode() (code string, err error) {
+	b := make([]byte, shareCodeLength)
+	max := big.NewInt(int64(len(shareCodeAlphabet)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = shareCodeAlphabet[n.Int64()]
+	}
+	return string(b), nil
+}
+
+// CreateShare 產生收藏夾的分享碼，同一個收藏夾已經分享過時沿用舊的分享碼
+func CreateShare(meta *models.Model, userId string, collectionId string) (share *Share, err error) {
+	query := bson.M{"user_id": userId, "collection_id": collectionId}
+	if err := meta.CollectionShare.Find(query).One(&share); err == nil {
+		return share, nil
+	} else if err != mgo.ErrNotFound {
+		return nil, err
+	}
+	for retry := 0; retry < 3; retry++ {
+		code, err := newShareCode()
+		if err != nil {
+			return nil, err
+		}
+		share = &Share{Code: code, UserId: userId, CollectionId: collectionId, CreatedAt: time.Now()}
+		if err = meta.CollectionShare.Insert(share); err == nil {
+			return share, nil
+		} else if !mgo.IsDup(err) {
+			meta.Log.Println(err)
+			return nil, err
+		}
+		// 同一個收藏夾同時分享兩次時，唯一索引會擋下第二筆，直接用先建立的分享碼
+		if err := meta.CollectionShare.Find(query).One(&share); err == nil {
+			return share, nil
+		}
+	}
+	return nil, errors.New("unable to generate a unique share code")
+}
+
+// GetShare 依分享碼取出分享，找不到時回傳 ErrShareNotFound
+func GetShare(meta *models.Model, code string) (share *Share, err error) {
+	if err := meta.CollectionShare.FindId(code).One(&share); err == mgo.ErrNotFound {
+		return nil, ErrShareNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return share, nil
+}
+
+// RevokeShare 讓收藏夾的分享碼失效，之後再分享會產生新的分享碼
+func RevokeShare(meta *models.Model, userId string, collectionId string) (revoked bool, err error) {
+	info, err := meta.CollectionShare.RemoveAll(bson.M{"user_id": userId, "collection_id": collectionId})
+	if err != nil {
+		meta.Log.Println(err)
+		return false, err
+	}
+	return info.Removed > 0, nil
+}
+
+// GetArticleIds 取出分享的文章 id (依加入順序)，擁有者刪掉收藏夾時回傳 ErrShareNotFound
+func (s *Share) GetArticleIds(meta *models.Model) (articleIds []string, name string, err error) {
+	owner := &UserFavorite{UserId: s.UserId}
+	userData, err := owner.Get(meta)
+	if err == mgo.ErrNotFound {
+		return nil, "", ErrShareNotFound
+	} else if err != nil {
+		return nil, "", err
+	}
+	if s.CollectionId == "" {
+		return userData.FavoriteIds(), "", nil
+	}
+	collection := userData.GetCollection(s.CollectionId)
+	if collection == nil {
+		return nil, "", ErrShareNotFound
+	}
+	return collection.Articles, collection.Name, nil
+}
+
+// CopyFavorites 把文章加入最愛，已經在最愛裡的略過，回傳新加入的篇數
+func (u *UserFavorite) CopyFavorites(meta *models.Model, articleIds []string) (count int, err error) {
+	for _, articleId := range articleIds {
+		added, err := u.AddFavorite(meta, articleId)
+		if err != nil {
+			return count, err
+		}
+		if added {
+			count++
+		}
+	}
+	return count, nil
+}
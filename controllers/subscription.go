@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"strings"
+
+	"github.com/mong0520/linebot-ptt-beauty/models"
+	"github.com/mong0520/linebot-ptt-beauty/utils"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// 訂閱的種類，同時也是 Subscription 裡的欄位名稱
+const (
+	SubscribeKeyword  string = "keywords"
+	SubscribeAuthor   string = "authors"
+	SubscribeCategory string = "categories"
+)
+
+// Subscription 是使用者的新文章通知設定，每個使用者一筆
+type Subscription struct {
+	UserId     string   `json:"user_id" bson:"user_id"`
+	Keywords   []string `json:"keywords" bson:"keywords"`
+	Authors    []string `json:"authors" bson:"authors"`
+	Categories []string `json:"categories" bson:"categories"`
+	// 勿擾時段 (台灣時間 "HH:MM")，期間符合的文章先放在 Pending，結束後再推播
+	QuietStart string   `json:"quiet_start" bson:"quiet_start,omitempty"`
+	QuietEnd   string   `json:"quiet_end" bson:"quiet_end,omitempty"`
+	Pending    []string `json:"pending" bson:"pending"`
+	// 每天推播次數上限用，PushDate 是台灣時間的日期
+	PushDate  string `json:"push_date" bson:"push_date,omitempty"`
+	PushCount int    `json:"push_count" bson:"push_count"`
+}
+
+// Get 取出使用者的訂閱，還沒有記錄時回傳空的設定
+func (s *Subscription) Get(meta *models.Model) (result *Subscription, err error) {
+	query := bson.M{"user_id": s.UserId}
+	if err := meta.CollectionSubscription.Find(query).One(&result); err == mgo.ErrNotFound {
+		return &Subscription{UserId: s.UserId}, nil
+	} else if err != nil {
+		meta.Log.Println(err)
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *Subscription) Add(meta *models.Model, kind string, value string) (err error) {
+	return s.upsert(meta, bson.M{"$addToSet": bson.M{kind: value}})
+}
+
+func (s *Subscription) Remove(meta *models.Model, kind string, value string) (err error) {
+	return s.upsert(meta, bson.M{"$pull": bson.M{kind: value}})
+}
+
+// SetQuietHours 設定勿擾時段，start 為空時取消
+func (s *Subscription) SetQuietHours(meta *models.Model, start string, end string) (err error) {
+	if start == "" {
+		return s.upsert(meta, bson.M{"$unset": bson.M{"quiet_start": "", "quiet_end": ""}})
+	}
+	return s.upsert(meta, bson.M{"$set": bson.M{"quiet_start": start, "quiet_end": end}})
+}
+
+func (s *Subscription) Count() int {
+	return len(s.Keywords) + len(s.Authors) + len(s.Categories)
+}
+
+// Match 判斷文章是否符合任何一個訂閱，關鍵字與作者不分大小寫
+func (s *Subscription) Match(article *models.ArticleDocument) bool {
+	title := strings.ToLower(article.ArticleTitle)
+	for _, keyword := range s.Keywords {
+		if strings.Contains(title, strings.ToLower(keyword)) {
+			return true
+		}
+	}
+	// 作者欄位是 "id (暱稱)"，只比對 id
+	if fields := strings.Fields(article.Author); len(fields) > 0 {
+		for _, author := range s.Authors {
+			if strings.EqualFold(fields[0], author) {
+				return true
+			}
+		}
+	}
+	category, _ := utils.SplitArticleTitle(article.ArticleTitle)
+	for _, c := range s.Categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// AddPending 加入待推播的文章，只保留最新的 max 篇
+func (s *Subscription) AddPending(meta *models.Model, articleIds []string, max int) (err error) {
+	update := bson.M{"$push": bson.M{"pending": bson.M{"$each": articleIds, "$slice": -max}}}
+	return s.update(meta, update)
+}
+
+func (s *Subscription) ClearPending(meta *models.Model, articleIds []string) (err error) {
+	return s.update(meta, bson.M{"$pullAll": bson.M{"pending": articleIds}})
+}
+
+// ReservePush 在今天的推播次數未達 limit 時佔用一次並回傳 true，多個工作同時執行也不會超過上限
+func (s *Subscription) ReservePush(meta *models.Model, date string, limit int) (ok bool, err error) {
+	query := bson.M{"user_id": s.UserId, "push_date": date, "push_count": bson.M{"$lt": limit}}
+	err = meta.CollectionSubscription.Update(query, bson.M{"$inc": bson.M{"push_count": 1}})
+	if err == nil {
+		return true, nil
+	} else if err != mgo.ErrNotFound {
+		return false, err
+	}
+	query = bson.M{"user_id": s.UserId, "push_date": bson.M{"$ne": date}}
+	err = meta.CollectionSubscription.Update(query, bson.M{"$set": bson.M{"push_date": date, "push_count": 1}})
+	if err == mgo.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ReleasePush 推播失敗時歸還 ReservePush 佔用的次數
+func (s *Subscription) ReleasePush(meta *models.Model, date string) (err error) {
+	query := bson.M{"user_id": s.UserId, "push_date": date, "push_count": bson.M{"$gt": 0}}
+	err = meta.CollectionSubscription.Update(query, bson.M{"$inc": bson.M{"push_count": -1}})
+	if err != nil && err != mgo.ErrNotFound {
+		meta.Log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// update 只更新已經存在的訂閱，推播工作執行期間使用者刪除資料時不會重新建立
+func (s *Subscription) update(meta *models.Model, update bson.M) (err error) {
+	query := bson.M{"user_id": s.UserId}
+	if err := meta.CollectionSubscription.Update(query, update); err != nil && err != mgo.ErrNotFound {
+		meta.Log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (s *Subscription) upsert(meta *models.Model, update bson.M) (err error) {
+	query := bson.M{"user_id": s.UserId}
+	if _, err := meta.CollectionSubscription.Upsert(query, update); err != nil {
+		meta.Log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// GetAllSubscriptions 取出至少訂閱一項的使用者
+func GetAllSubscriptions(meta *models.Model) (results []Subscription, err error) {
+	query := bson.M{"$or": []bson.M{
+		{"keywords.0": bson.M{"$exists": true}},
+		{"authors.0": bson.M{"$exists": true}},
+		{"categories.0": bson.M{"$exists": true}},
+	}}
+	if err := meta.CollectionSubscription.Find(query).All(&results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func GetPendingSubscriptions(meta *models.Model) (results []Subscription, err error) {
+	query := bson.M{"pending.0": bson.M{"$exists": true}}
+	if err := meta.CollectionSubscription.Find(query).All(&results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// GetInactiveUserIds 取出封鎖機器人的使用者，推播時要跳過
+func GetInactiveUserIds(meta *models.Model) (userIds map[string]bool, err error) {
+	results := []UserFavorite{}
+	query := meta.CollectionUserFavorite.Find(bson.M{"inactive": true}).Select(bson.M{"user_id": 1})
+	if err := query.All(&results); err != nil {
+		return nil, err
+	}
+	userIds = map[string]bool{}
+	for _, r := range results {
+		userIds[r.UserId] = true
+	}
+	return userIds, nil
+}
+
+// GetNewArticles 依匯入順序 (_id) 取出 after 之後的文章
+func GetNewArticles(collection *mgo.Collection, after bson.ObjectId, count int) (results []models.ArticleDocument, err error) {
+	query := bson.M{}
+	if after != "" {
+		query = bson.M{"_id": bson.M{"$gt": after}}
+	}
+	if err := collection.Find(query).Sort("_id").Limit(count).All(&results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// GetLatestArticleId 回傳最後匯入的文章，沒有文章時回傳空字串
+func GetLatestArticleId(collection *mgo.Collection) (id bson.ObjectId, err error) {
+	result := &models.ArticleDocument{}
+	if err := collection.Find(nil).Sort("-_id").One(result); err == mgo.ErrNotFound {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return result.ID, nil
+}
+
+// GetByIds 依文章 id 取出文章，新的在前，找不到的直接略過
+func GetByIds(collection *mgo.Collection, articleIds []string) (results []models.ArticleDocument, err error) {
+	query := bson.M{"article_id": bson.M{"$in": articleIds}}
+	if err := collection.Find(query).Sort("-timestamp").All(&results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
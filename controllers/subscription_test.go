@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/mong0520/linebot-ptt-beauty/models"
+)
+
+func TestSubscriptionMatch(t *testing.T) {
+	subscription := &Subscription{
+		Keywords:   []string{"新垣結衣", "Gakki"},
+		Authors:    []string{"ckpot"},
+		Categories: []string{"帥哥"},
+	}
+	tests := []struct {
+		name    string
+		title   string
+		author  string
+		matched bool
+	}{
+		{"keyword in title", "[正妹] 新垣結衣 逃恥", "someone (路人)", true},
+		{"keyword ignores case", "[正妹] gakki 日常", "someone", true},
+		{"author id", "[正妹] 路人", "ckpot (暱稱)", true},
+		{"author ignores case", "[正妹] 路人", "CKPOT", true},
+		{"author nickname is not matched", "[正妹] 路人", "someone (ckpot)", false},
+		{"category", "[帥哥] 路人", "someone", true},
+		{"category must be exact", "[正妹] 帥哥好多", "someone", false},
+		{"empty author", "[正妹] 路人", "", false},
+		{"nothing matched", "[正妹] 路人", "someone", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			article := &models.ArticleDocument{ArticleTitle: tt.title, Author: tt.author}
+			if got := subscription.Match(article); got != tt.matched {
+				t.Errorf("Match(%q, %q) = %v, want %v", tt.title, tt.author, got, tt.matched)
+			}
+		})
+	}
+
+	if (&Subscription{}).Match(&models.ArticleDocument{ArticleTitle: "[正妹] 路人", Author: "ckpot"}) {
+		t.Error("empty subscription should match nothing")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"github.com/mong0520/linebot-ptt-beauty/models"
 	"gopkg.in/mgo.v2"
 	"log"
@@ -25,10 +26,23 @@ func initDB() {
 		meta.Session = session
 		meta.Collection = session.DB("ptt").C("beauty")
 		meta.CollectionUserFavorite = session.DB("ptt").C("users")
+		meta.CollectionAudit = session.DB("ptt").C("audit")
+		meta.CollectionGroup = session.DB("ptt").C("groups")
+		meta.CollectionSubscription = session.DB("ptt").C("subscriptions")
+		meta.CollectionJob = session.DB("ptt").C("jobs")
+		meta.CollectionDigest = session.DB("ptt").C("digests")
+		meta.CollectionDelivery = session.DB("ptt").C("deliveries")
+		meta.CollectionOrphan = session.DB("ptt").C("orphans")
+		meta.CollectionShare = session.DB("ptt").C("shares")
+		meta.CollectionSettings = session.DB("ptt").C("settings")
+		meta.CollectionExport = session.DB("ptt").C("exports")
 	}
 }
 
 func main() {
+	richMenuConfig := flag.String("richmenu", "", "create and set the default rich menu from the config file, then exit")
+	flag.Parse()
+
 	logFile, err := initLogFile()
 	defer logFile.Close()
 
@@ -37,6 +51,12 @@ func main() {
 	}
 	logger = utils.GetLogger(logFile)
 	meta.Log = logger
+	if *richMenuConfig != "" {
+		if err := bots.SetupRichMenu(meta, *richMenuConfig); err != nil {
+			meta.Log.Fatalln("Unable to setup rich menu", err)
+		}
+		return
+	}
 	meta.Log.Println("Start to init DB...")
 	initDB()
 	meta.Log.Println("...Done")
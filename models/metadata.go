@@ -5,14 +5,24 @@ import (
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 	"log"
+	"sort"
+	"strings"
 )
 
-
-
 type Model struct {
 	Session                *mgo.Session
 	Collection             *mgo.Collection
 	CollectionUserFavorite *mgo.Collection
+	CollectionAudit        *mgo.Collection
+	CollectionGroup        *mgo.Collection
+	CollectionSubscription *mgo.Collection
+	CollectionJob          *mgo.Collection
+	CollectionDigest       *mgo.Collection
+	CollectionDelivery     *mgo.Collection
+	CollectionOrphan       *mgo.Collection
+	CollectionShare        *mgo.Collection
+	CollectionSettings     *mgo.Collection
+	CollectionExport       *mgo.Collection
 	Log                    *log.Logger
 }
 
@@ -24,20 +34,27 @@ type MessageCount struct {
 	Push    int `json:"push" bson:"push"`
 }
 
+type ArticleMessage struct {
+	PushTag        string `json:"push_tag" bson:"push_tag"`
+	PushUserID     string `json:"push_userid" bson:"push_userid"`
+	PushContent    string `json:"push_content" bson:"push_content"`
+	PushIPDateTime string `json:"push_ipdatetime" bson:"push_ipdatetime"`
+}
+
 type ArticleDocument struct {
-	ID           bson.ObjectId `bson:"_id,omitempty"`
-	ArticleID    string        `json:"article_id" bson:"article_id"`
-	ArticleTitle string        `json:"article_title" bson:"article_title"`
-	Author       string        `json:"author" bson:"author"`
-	Board        string        `json:"board" bson:"board"`
-	Content      string        `json:"content" bson:"content"`
-	Date         string        `json:"date" bson:"date"`
-	IP           string        `json:"ip" bson:"ip"`
-	MessageCount MessageCount  `bson:"message_count"`
-	Messages     []interface{} `json:"messages" bson:"messages"`
-	Timestamp    int           `json:"timestamp" bson:"timestamp"`
-	URL          string        `json:"url" bson:"url"`
-	ImageLinks   []string      `json:"image_links" bson:"image_links"`
+	ID           bson.ObjectId    `bson:"_id,omitempty"`
+	ArticleID    string           `json:"article_id" bson:"article_id"`
+	ArticleTitle string           `json:"article_title" bson:"article_title"`
+	Author       string           `json:"author" bson:"author"`
+	Board        string           `json:"board" bson:"board"`
+	Content      string           `json:"content" bson:"content"`
+	Date         string           `json:"date" bson:"date"`
+	IP           string           `json:"ip" bson:"ip"`
+	MessageCount MessageCount     `bson:"message_count"`
+	Messages     []ArticleMessage `json:"messages" bson:"messages"`
+	Timestamp    int              `json:"timestamp" bson:"timestamp"`
+	URL          string           `json:"url" bson:"url"`
+	ImageLinks   []string         `json:"image_links" bson:"image_links"`
 }
 
 func (d *ArticleDocument) GeneralQueryOne(collection *mgo.Collection, query interface{}) (result *ArticleDocument, err error) {
@@ -67,6 +84,50 @@ func (d *ArticleDocument) GeneralQueryAll(collection *mgo.Collection, query inte
 
 }
 
+// PushMessages 只取出推文，保留原本的順序
+func (d *ArticleDocument) PushMessages() (messages []ArticleMessage) {
+	for _, m := range d.Messages {
+		if strings.TrimSpace(m.PushTag) == "推" {
+			messages = append(messages, m)
+		}
+	}
+	return messages
+}
+
+// PushComment 是內容相同的推文合併後的結果，Count 是推了同樣內容的人數
+type PushComment struct {
+	ArticleMessage
+	Count int
+}
+
+// TopPushMessages 把內容相同的推文合併，依推文人數由多到少排序，人數相同時保留原本的順序
+func (d *ArticleDocument) TopPushMessages() (comments []PushComment) {
+	index := map[string]int{}
+	users := map[string]map[string]bool{}
+	for _, m := range d.PushMessages() {
+		content := strings.TrimSpace(strings.TrimPrefix(m.PushContent, ":"))
+		if content == "" {
+			continue
+		}
+		idx, ok := index[content]
+		if !ok {
+			idx = len(comments)
+			index[content] = idx
+			users[content] = map[string]bool{}
+			comments = append(comments, PushComment{ArticleMessage: m})
+		}
+		// 同一個人重複推一樣的內容只算一次
+		if !users[content][m.PushUserID] {
+			users[content][m.PushUserID] = true
+			comments[idx].Count++
+		}
+	}
+	sort.SliceStable(comments, func(i, j int) bool {
+		return comments[i].Count > comments[j].Count
+	})
+	return comments
+}
+
 func (d *ArticleDocument) ToString() (info string) {
 	b, err := json.Marshal(d)
 	if err != nil {
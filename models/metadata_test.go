@@ -0,0 +1,51 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTopPushMessages(t *testing.T) {
+	push := func(tag string, user string, content string) ArticleMessage {
+		return ArticleMessage{PushTag: tag, PushUserID: user, PushContent: content}
+	}
+	tests := []struct {
+		name     string
+		messages []ArticleMessage
+		want     []string
+		counts   []int
+	}{
+		{"merge same content and sort by users", []ArticleMessage{
+			push("推 ", "a", ": 正"),
+			push("推 ", "b", ": 好正"),
+			push("推 ", "c", ":好正 "),
+			push("推 ", "d", ": 好正"),
+			push("推 ", "e", ": 正"),
+		}, []string{": 好正", ": 正"}, []int{3, 2}},
+		{"same user counted once", []ArticleMessage{
+			push("推 ", "a", ": 正"),
+			push("推 ", "a", ": 正"),
+			push("推 ", "b", ": 讚"),
+		}, []string{": 正", ": 讚"}, []int{1, 1}},
+		{"skip boo, arrow and empty content", []ArticleMessage{
+			push("噓 ", "a", ": 不正"),
+			push("→ ", "b", ": 路過"),
+			push("推 ", "c", ":  "),
+			push("推 ", "d", ": 正"),
+		}, []string{": 正"}, []int{1}},
+		{"no messages", nil, []string{}, []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			document := &ArticleDocument{Messages: tt.messages}
+			contents, counts := []string{}, []int{}
+			for _, c := range document.TopPushMessages() {
+				contents = append(contents, c.PushContent)
+				counts = append(counts, c.Count)
+			}
+			if !reflect.DeepEqual(contents, tt.want) || !reflect.DeepEqual(counts, tt.counts) {
+				t.Errorf("TopPushMessages = %q %v, want %q %v", contents, counts, tt.want, tt.counts)
+			}
+		})
+	}
+}
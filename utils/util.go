@@ -1,14 +1,24 @@
 package utils
 
 import (
+    "crypto/sha256"
+    "encoding/hex"
     "os"
     "log"
     "io"
     "time"
     "math/rand"
     "reflect"
+    "regexp"
+    "strings"
+    "unicode/utf8"
 )
 
+var urlPattern = regexp.MustCompile(`https?://\S+`)
+var blankLinesPattern = regexp.MustCompile(`\n{3,}`)
+var articleHeaders = []string{"作者", "看板", "標題", "時間"}
+var titleCategoryPattern = regexp.MustCompile(`^\s*\[([^\]]+)\]\s*(.*)$`)
+
 func GetLogger(f *os.File)(logger *log.Logger){
     if f != nil{
         logger = log.New(io.MultiWriter(os.Stdout, f), "", log.LstdFlags | log.Lshortfile)
@@ -49,3 +59,73 @@ func InArray(val interface{}, array interface{}) (exists bool, index int) {
 func RemoveStringItem(slice []string, s int) []string {
     return append(slice[:s], slice[s+1:]...)
 }
+
+// GetTaipeiLocation 回傳台灣時區，系統沒有 tzdata 時退回固定 +8
+func GetTaipeiLocation() *time.Location {
+    if loc, err := time.LoadLocation("Asia/Taipei"); err == nil {
+        return loc
+    }
+    return time.FixedZone("CST", 8*60*60)
+}
+
+// CleanArticleContent 去掉 PTT 文章的檔頭、簽名檔、網址與 -- 之後的頁尾
+func CleanArticleContent(content string) string {
+    content = strings.Replace(content, "\r\n", "\n", -1)
+    // 最後一個 -- 之後是簽名檔與發信站資訊
+    if idx := strings.LastIndex(content, "\n--\n"); idx >= 0 {
+        content = content[:idx]
+    } else if strings.HasPrefix(content, "--\n") {
+        content = ""
+    }
+    lines := []string{}
+    for _, line := range strings.Split(content, "\n") {
+        trimmed := strings.TrimSpace(line)
+        if strings.HasPrefix(trimmed, "※") || isArticleHeader(trimmed) {
+            continue
+        }
+        line = urlPattern.ReplaceAllString(line, "")
+        lines = append(lines, strings.TrimRight(line, " \t"))
+    }
+    content = strings.Join(lines, "\n")
+    content = blankLinesPattern.ReplaceAllString(content, "\n\n")
+    return strings.TrimSpace(content)
+}
+
+func isArticleHeader(line string) bool {
+    for _, header := range articleHeaders {
+        if strings.HasPrefix(line, header+" ") || strings.HasPrefix(line, header+":") {
+            return true
+        }
+    }
+    return false
+}
+
+// SplitArticleTitle 把 "[正妹] 標題" 拆成分類與標題，沒有分類時回傳 "表特"
+func SplitArticleTitle(articleTitle string) (category string, title string) {
+    if m := titleCategoryPattern.FindStringSubmatch(articleTitle); m != nil {
+        return m[1], m[2]
+    }
+    return "表特", articleTitle
+}
+
+// TruncateRunes 以字元(而非 byte)為單位截斷字串，超過 limit 時最後一字換成 …
+func TruncateRunes(s string, limit int) string {
+    if limit <= 0 {
+        return ""
+    }
+    if utf8.RuneCountInString(s) <= limit {
+        return s
+    }
+    runes := []rune(s)
+    return string(runes[:limit-1]) + "…"
+}
+
+// RedactID 把 Line 的 user/group/room id 換成不可還原的短代號，記錄檔裡只寫代號。
+// 同一個 id 的代號固定，仍然可以追查同一個人的操作；空字串保持空字串
+func RedactID(id string) string {
+    if id == "" {
+        return ""
+    }
+    sum := sha256.Sum256([]byte(id))
+    return id[:1] + "#" + hex.EncodeToString(sum[:4])
+}
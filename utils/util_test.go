@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestTruncateRunes(t *testing.T) {
+	tests := []struct {
+		name  string
+		s     string
+		limit int
+		want  string
+	}{
+		{"shorter than limit", "正妹", 5, "正妹"},
+		{"exactly the limit", "正妹帥哥", 4, "正妹帥哥"},
+		{"cut by runes not bytes", "[正妹] 新垣結衣", 6, "[正妹] …"},
+		{"ascii", "abcdef", 3, "ab…"},
+		{"limit of one", "abc", 1, "…"},
+		{"zero limit", "abc", 0, ""},
+		{"negative limit", "abc", -1, ""},
+		{"empty string", "", 3, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TruncateRunes(tt.s, tt.limit); got != tt.want {
+				t.Errorf("TruncateRunes(%q, %d) = %q, want %q", tt.s, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactID(t *testing.T) {
+	pattern := regexp.MustCompile(`^[UCR]#[0-9a-f]{8}$`)
+	tests := []struct {
+		name string
+		id   string
+	}{
+		{"user", "U4af4980629e5a1b2c3d4e5f6a7b8c9d0"},
+		{"group", "C1234567890abcdef1234567890abcdef"},
+		{"room", "R1234567890abcdef1234567890abcdef"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redacted := RedactID(tt.id)
+			if !pattern.MatchString(redacted) {
+				t.Errorf("RedactID(%q) = %q, want pattern %s", tt.id, redacted, pattern)
+			}
+			if strings.Contains(redacted, tt.id[1:9]) {
+				t.Errorf("RedactID(%q) = %q leaks the id", tt.id, redacted)
+			}
+			if again := RedactID(tt.id); again != redacted {
+				t.Errorf("RedactID is not stable: %q != %q", again, redacted)
+			}
+		})
+	}
+	if RedactID("") != "" {
+		t.Error("empty id should stay empty")
+	}
+	if RedactID("Uaaaa") == RedactID("Ubbbb") {
+		t.Error("different ids should get different codes")
+	}
+}